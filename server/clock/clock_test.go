@@ -0,0 +1,30 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeFiresDueTimersOnAdvance(t *testing.T) {
+	c := NewFake(time.Unix(0, 0))
+	fired := make(chan string, 2)
+	c.AfterFunc(time.Second, func() { fired <- "soon" })
+	late := c.AfterFunc(time.Minute, func() { fired <- "late" })
+
+	next, ok := c.Next()
+	require.True(t, ok)
+	require.Equal(t, time.Unix(1, 0), next)
+
+	c.Advance(time.Second)
+	require.Equal(t, "soon", <-fired)
+	require.Equal(t, time.Unix(1, 0), c.Now())
+
+	require.True(t, late.Stop())
+	require.False(t, late.Stop())
+	c.Advance(time.Hour)
+	_, ok = c.Next()
+	require.False(t, ok)
+	require.Empty(t, fired)
+}
@@ -0,0 +1,277 @@
+// Package config loads the server's settings: built-in defaults, overlaid by
+// an optional JSON file, overlaid by environment variables.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jollygrin/tts-server/game"
+	"github.com/jollygrin/tts-server/lobby"
+)
+
+// Config is every setting the server takes. The JSON field names are the
+// config file's keys; the env var overriding each one is listed beside it.
+type Config struct {
+	Addr        string `json:"addr"`        // PORT (as ":<port>")
+	MetricsAddr string `json:"metricsAddr"` // METRICS_ADDR
+	Debug       bool   `json:"debug"`       // DEBUG
+	AdminToken  string `json:"adminToken"`  // ADMIN_TOKEN
+	// DrainDelay is how long /readyz reports not-ready after SIGTERM before
+	// lobbies are closed, so the platform stops routing new players here.
+	DrainDelay Duration `json:"drainDelay"` // DRAIN_DELAY
+
+	AllowedOrigins []string `json:"allowedOrigins"` // ALLOWED_ORIGINS, comma-separated
+	// TrustedProxies are the CIDRs of the proxies in front of the server,
+	// whose X-Forwarded-For is believed; unset, there is no per-IP cap and
+	// bans don't reach addresses.
+	TrustedProxies []string `json:"trustedProxies"` // TRUSTED_PROXIES, comma-separated
+
+	MaxLobbies         int `json:"maxLobbies"`         // MAX_LOBBIES
+	MaxClientsPerLobby int `json:"maxClientsPerLobby"` // MAX_CLIENTS_PER_LOBBY
+	MaxConnsPerIP      int `json:"maxConnsPerIP"`      // MAX_CONNS_PER_IP
+	MaxPlayersPerLobby int `json:"maxPlayersPerLobby"` // MAX_PLAYERS_PER_LOBBY
+	MaxStateBytes      int `json:"maxStateBytes"`      // MAX_STATE_BYTES
+
+	OfflineGrace  Duration `json:"offlineGrace"`  // OFFLINE_GRACE
+	EmptyLobbyTTL Duration `json:"emptyLobbyTTL"` // EMPTY_LOBBY_TTL
+	ReadLimit     int64    `json:"readLimit"`     // READ_LIMIT
+	GameBuffer    int      `json:"gameBuffer"`    // GAME_BUFFER
+	SendBuffer    int      `json:"sendBuffer"`    // SEND_BUFFER
+	WriteTimeout  Duration `json:"writeTimeout"`  // WRITE_TIMEOUT
+	StallTimeout  Duration `json:"stallTimeout"`  // STALL_TIMEOUT
+	PingInterval  Duration `json:"pingInterval"`  // PING_INTERVAL
+	PongTimeout   Duration `json:"pongTimeout"`   // PONG_TIMEOUT
+	MessageRate   float64  `json:"messageRate"`   // MESSAGE_RATE
+	MessageBurst  int      `json:"messageBurst"`  // MESSAGE_BURST
+	ChatHistory   int      `json:"chatHistory"`   // CHAT_HISTORY
+	ChatLength    int      `json:"chatLength"`    // CHAT_LENGTH
+	LogHistory    int      `json:"logHistory"`    // LOG_HISTORY
+	ClockTick     Duration `json:"clockTick"`     // CLOCK_TICK
+	Seats         int      `json:"seats"`         // SEATS
+	Capacity      int      `json:"capacity"`      // CAPACITY
+}
+
+// Duration is a time.Duration written as a string in the config file ("5s",
+// "15m").
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Default is the configuration with no file and no environment.
+func Default() Config {
+	l := lobby.DefaultConfig()
+	return Config{
+		Addr:               ":8080",
+		DrainDelay:         Duration(5 * time.Second),
+		AllowedOrigins:     l.Origins,
+		MaxLobbies:         l.Quotas.MaxLobbies,
+		MaxClientsPerLobby: l.Quotas.MaxClientsPerLobby,
+		MaxConnsPerIP:      l.Quotas.MaxConnsPerIP,
+		MaxPlayersPerLobby: l.Game.Limits.MaxPlayers,
+		MaxStateBytes:      l.Game.Limits.MaxStateBytes,
+		OfflineGrace:       Duration(l.Game.OfflineGrace),
+		EmptyLobbyTTL:      Duration(l.EmptyLobbyTTL),
+		ReadLimit:          l.ReadLimit,
+		GameBuffer:         l.Game.OutBuffer,
+		SendBuffer:         l.SendBuffer,
+		WriteTimeout:       Duration(l.WriteTimeout),
+		StallTimeout:       Duration(l.StallTimeout),
+		PingInterval:       Duration(l.PingInterval),
+		PongTimeout:        Duration(l.PongTimeout),
+		MessageRate:        l.MessageRate,
+		MessageBurst:       l.MessageBurst,
+		ChatHistory:        l.Game.ChatHistory,
+		ChatLength:         l.Game.ChatLength,
+		LogHistory:         l.Game.LogHistory,
+		ClockTick:          Duration(l.Game.ClockTick),
+		Seats:              l.Game.Seats,
+		Capacity:           l.Game.Capacity,
+	}
+}
+
+// Load builds the configuration from the defaults, the JSON file at path (if
+// path is not empty) and the environment. Unknown file keys and unparseable
+// env values are errors, not silently ignored; call Validate once any
+// command-line overrides are applied.
+func Load(path string) (Config, error) {
+	c := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return c, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			return c, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return c, c.applyEnv(os.LookupEnv)
+}
+
+// applyEnv overlays the env vars that are set, collecting every bad value.
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v, ok := lookup(name); ok && v != "" {
+			*dst = v
+		}
+	}
+	parse := func(name string, set func(string) error) {
+		if v, ok := lookup(name); ok && v != "" {
+			if err := set(v); err != nil {
+				errs = append(errs, fmt.Errorf("%s=%q: %w", name, v, err))
+			}
+		}
+	}
+	integer := func(name string, dst *int) {
+		parse(name, func(v string) error {
+			n, err := strconv.Atoi(v)
+			*dst = n
+			return err
+		})
+	}
+	duration := func(name string, dst *Duration) {
+		parse(name, func(v string) error {
+			d, err := time.ParseDuration(v)
+			*dst = Duration(d)
+			return err
+		})
+	}
+	list := func(name string, dst *[]string) {
+		parse(name, func(v string) error {
+			*dst = nil
+			for _, p := range strings.Split(v, ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					*dst = append(*dst, p)
+				}
+			}
+			return nil
+		})
+	}
+
+	parse("PORT", func(v string) error {
+		c.Addr = ":" + v
+		return nil
+	})
+	str("METRICS_ADDR", &c.MetricsAddr)
+	parse("DEBUG", func(v string) (err error) {
+		c.Debug, err = strconv.ParseBool(v)
+		return err
+	})
+	str("ADMIN_TOKEN", &c.AdminToken)
+	duration("DRAIN_DELAY", &c.DrainDelay)
+	list("ALLOWED_ORIGINS", &c.AllowedOrigins)
+	list("TRUSTED_PROXIES", &c.TrustedProxies)
+	integer("MAX_LOBBIES", &c.MaxLobbies)
+	integer("MAX_CLIENTS_PER_LOBBY", &c.MaxClientsPerLobby)
+	integer("MAX_CONNS_PER_IP", &c.MaxConnsPerIP)
+	integer("MAX_PLAYERS_PER_LOBBY", &c.MaxPlayersPerLobby)
+	integer("MAX_STATE_BYTES", &c.MaxStateBytes)
+	duration("OFFLINE_GRACE", &c.OfflineGrace)
+	duration("EMPTY_LOBBY_TTL", &c.EmptyLobbyTTL)
+	parse("READ_LIMIT", func(v string) (err error) {
+		c.ReadLimit, err = strconv.ParseInt(v, 10, 64)
+		return err
+	})
+	integer("GAME_BUFFER", &c.GameBuffer)
+	integer("SEND_BUFFER", &c.SendBuffer)
+	duration("WRITE_TIMEOUT", &c.WriteTimeout)
+	duration("STALL_TIMEOUT", &c.StallTimeout)
+	duration("PING_INTERVAL", &c.PingInterval)
+	duration("PONG_TIMEOUT", &c.PongTimeout)
+	parse("MESSAGE_RATE", func(v string) (err error) {
+		c.MessageRate, err = strconv.ParseFloat(v, 64)
+		return err
+	})
+	integer("MESSAGE_BURST", &c.MessageBurst)
+	integer("CHAT_HISTORY", &c.ChatHistory)
+	integer("CHAT_LENGTH", &c.ChatLength)
+	integer("LOG_HISTORY", &c.LogHistory)
+	duration("CLOCK_TICK", &c.ClockTick)
+	integer("SEATS", &c.Seats)
+	integer("CAPACITY", &c.Capacity)
+	return errors.Join(errs...)
+}
+
+// Validate reports every setting the server can't start with.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr must be set"))
+	}
+	if c.DrainDelay < 0 {
+		errs = append(errs, errors.New("drainDelay must not be negative"))
+	}
+	if c.MetricsAddr != "" && c.MetricsAddr == c.Addr {
+		errs = append(errs, errors.New("metricsAddr must differ from addr"))
+	}
+	return errors.Join(append(errs, c.Lobby().Validate())...)
+}
+
+// Lobby is the part of the configuration lobby.New takes.
+func (c Config) Lobby() lobby.Config {
+	l := lobby.DefaultConfig()
+	l.AdminToken = c.AdminToken
+	l.Origins = c.AllowedOrigins
+	l.TrustedProxies = c.TrustedProxies
+	l.Quotas = lobby.Quotas{
+		MaxLobbies:         c.MaxLobbies,
+		MaxClientsPerLobby: c.MaxClientsPerLobby,
+		MaxConnsPerIP:      c.MaxConnsPerIP,
+	}
+	l.Game = game.Config{
+		Limits: game.Limits{
+			MaxPlayers:    c.MaxPlayersPerLobby,
+			MaxStateBytes: c.MaxStateBytes,
+		},
+		OfflineGrace: time.Duration(c.OfflineGrace),
+		OutBuffer:    c.GameBuffer,
+		ChatHistory:  c.ChatHistory,
+		ChatLength:   c.ChatLength,
+		LogHistory:   c.LogHistory,
+		ClockTick:    time.Duration(c.ClockTick),
+		Seats:        c.Seats,
+		Capacity:     c.Capacity,
+	}
+	l.EmptyLobbyTTL = time.Duration(c.EmptyLobbyTTL)
+	l.ReadLimit = c.ReadLimit
+	l.SendBuffer = c.SendBuffer
+	l.WriteTimeout = time.Duration(c.WriteTimeout)
+	l.StallTimeout = time.Duration(c.StallTimeout)
+	l.PingInterval = time.Duration(c.PingInterval)
+	l.PongTimeout = time.Duration(c.PongTimeout)
+	l.MessageRate = c.MessageRate
+	l.MessageBurst = c.MessageBurst
+	return l
+}
+
+// Redacted is c with its secrets blanked, safe to log.
+func (c Config) Redacted() Config {
+	if c.AdminToken != "" {
+		c.AdminToken = "[redacted]"
+	}
+	return c
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultIsValid(t *testing.T) {
+	require.NoError(t, Default().Validate())
+}
+
+func TestLoadLayersFileThenEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tts.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"maxLobbies": 3,
+		"offlineGrace": "250ms",
+		"allowedOrigins": ["staging.example.com"],
+		"messageBurst": 40
+	}`), 0o600))
+	t.Setenv("PORT", "9000")
+	t.Setenv("MESSAGE_BURST", "5")
+	t.Setenv("ALLOWED_ORIGINS", " a.example , b.example,")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8")
+
+	c, err := Load(path)
+	require.NoError(t, err)
+	require.NoError(t, c.Validate())
+	require.Equal(t, ":9000", c.Addr)
+	require.Equal(t, 3, c.MaxLobbies, "file beats defaults")
+	require.Equal(t, 5, c.MessageBurst, "env beats the file")
+	require.Equal(t, []string{"a.example", "b.example"}, c.AllowedOrigins)
+
+	l := c.Lobby()
+	require.Equal(t, []string{"10.0.0.0/8"}, l.TrustedProxies)
+	require.Equal(t, 250*time.Millisecond, l.Game.OfflineGrace)
+	require.Equal(t, Default().SendBuffer, l.SendBuffer, "unset keys keep their default")
+}
+
+func TestLoadRejectsBadInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tts.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"maxLobbys": 3}`), 0o600))
+	_, err := Load(path)
+	require.ErrorContains(t, err, "maxLobbys", "a typo'd key must not be silently ignored")
+
+	t.Setenv("MAX_LOBBIES", "lots")
+	t.Setenv("EMPTY_LOBBY_TTL", "15")
+	_, err = Load("")
+	require.ErrorContains(t, err, "MAX_LOBBIES")
+	require.ErrorContains(t, err, "EMPTY_LOBBY_TTL")
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	c := Default()
+	c.MaxLobbies = -1
+	c.SendBuffer = 0
+	c.AllowedOrigins = []string{"*"}
+	err := c.Validate()
+	require.ErrorContains(t, err, "max lobbies must not be negative")
+	require.ErrorContains(t, err, "send buffer must be positive")
+	require.ErrorContains(t, err, `"*"`)
+}
+
+func TestRedactedHidesAdminToken(t *testing.T) {
+	c := Default()
+	c.AdminToken = "hunter2"
+	out, err := json.Marshal(c.Redacted())
+	require.NoError(t, err)
+	require.NotContains(t, string(out), "hunter2")
+	require.Contains(t, string(out), `"offlineGrace":"5s"`)
+	require.Equal(t, "hunter2", c.AdminToken, "the original is untouched")
+}
@@ -0,0 +1,162 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jollygrin/tts-server/jsonmerge"
+)
+
+// AdminID is the playerId on messages an admin causes.
+const AdminID = "admin"
+
+// Patch merges an admin's patch through the same path as a client update —
+// ownership rules as for a host, the state size limit — and broadcasts it to
+// the whole lobby.
+func (g *Game) Patch(raw json.RawMessage) error {
+	value, err := g.applyPatch(nil, raw)
+	if err != nil {
+		if errors.Is(err, errNothingToMerge) {
+			return nil
+		}
+		return err
+	}
+	g.relayUpdate(Message{
+		Type:      "update",
+		PlayerID:  AdminID,
+		Timestamp: time.Now().UnixMilli(),
+		Value:     value,
+	}, "")
+	return nil
+}
+
+// Reset replaces the table with state — nil for an empty table, or a GameDTO
+// — and re-syncs the whole lobby. Server-owned player fields in state are
+// dropped and rewritten from the live players, so presence and roles stay
+// accurate either way.
+func (g *Game) Reset(state map[string]any) error {
+	return g.resetTo(AdminID, state)
+}
+
+func (g *Game) resetTo(by string, state map[string]any) error {
+	if state == nil {
+		state = map[string]any{}
+	}
+	if _, reason := authorizePatch("", RoleHost, nil, state); reason != "" {
+		return &rejection{"invalid", errors.New(reason)}
+	}
+	// the new table's bags bring their contents, which stay on the server
+	pieces, _ := state["pieces"].(map[string]any)
+	pools, _, _, rej := bagContents(nil, pieces)
+	if rej != nil {
+		return rej
+	}
+
+	g.mu.Lock()
+	// players keep their seats across a reset, unless the new state seats
+	// them, which is an override like the host's
+	prev := make(map[*Player]int, len(g.Players))
+	for _, p := range g.Players {
+		prev[p] = p.Seat
+	}
+	restoreSeats := func() {
+		for p, seat := range prev {
+			p.Seat = seat
+		}
+	}
+	claims, rej := g.seatClaimsLocked(state)
+	if rej == nil && len(claims) > 0 {
+		var commit func()
+		if _, commit, _, rej = g.seatPatchLocked(claims, true); rej == nil {
+			commit()
+		}
+	}
+	if rej != nil {
+		g.mu.Unlock()
+		return rej
+	}
+	seats := seatsValue(g.seatCount)
+	for id, p := range g.Players {
+		row := serverRowLocked(p)
+		row["seat"] = seatJSON(p.Seat)
+		if p.Seat != NoSeat {
+			seats["taken"].(map[string]any)[strconv.Itoa(p.Seat)] = id
+		}
+		state = jsonmerge.MergeMaps(state, map[string]any{
+			"players": map[string]any{id: row},
+		})
+	}
+	state["seats"] = seats
+	// and the waiting room, which a reset neither opens nor empties
+	if g.capacity > 0 || len(g.waiting) > 0 {
+		state["lobby"] = g.lobbyValueLocked()
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		restoreSeats()
+		g.mu.Unlock()
+		return err
+	}
+	pooled := 0
+	for _, items := range pools {
+		pooled += encodedSize(items)
+	}
+	if max := g.limits.MaxStateBytes; max > 0 && len(data)+pooled > max {
+		restoreSeats()
+		g.mu.Unlock()
+		return ErrStateTooLarge
+	}
+	g.Data = state
+	clear(g.pools)
+	clear(g.poolBytes)
+	for id, items := range pools {
+		g.setPoolLocked(id, items)
+	}
+	g.turnState = nil
+	g.stopClocksLocked()
+	g.stateBytes = len(data)
+	g.Updates++
+	g.LastActivity = time.Now()
+	logged := g.recordLocked(by, logLine{"reset", by + " reset the table"})
+	g.mu.Unlock()
+
+	g.syncAll(by)
+	g.sendLog(logged)
+	return nil
+}
+
+// SyncAll sends every client a fresh sync — for when an admin suspects the
+// lobby has drifted.
+func (g *Game) SyncAll() error {
+	return g.syncAll(AdminID)
+}
+
+// syncAll sends every player a sync of the table as they may see it (see
+// hideTrays), attributed to by.
+func (g *Game) syncAll(by string) error {
+	now := time.Now().UnixMilli()
+	g.mu.Lock()
+	syncs := make([]*PlayerMessage, 0, len(g.Players))
+	for id := range g.Players {
+		data, err := json.Marshal(hideTrays(g.Data, id, g.Players))
+		if err != nil {
+			g.mu.Unlock()
+			return err
+		}
+		payload, _ := json.Marshal(Message{
+			Type:      "sync",
+			PlayerID:  by,
+			Timestamp: now,
+			Value:     data,
+		})
+		syncs = append(syncs, &PlayerMessage{To: []string{id}, Content: payload, Type: "sync"})
+	}
+	g.mu.Unlock()
+
+	for _, pm := range syncs {
+		g.send(pm)
+	}
+	return nil
+}
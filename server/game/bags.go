@@ -0,0 +1,498 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Bags keep their contents on the server. A bag is a piece of kind "bag";
+// what is in it lives in g.pools, keyed by the bag's piece id, and g.Data only
+// carries its count, so nobody can inspect a hidden pool — or an infinite
+// bag's template — by reading the state. Clients still fill a bag by writing
+// pieces[id].contents as they spawn it or load a scenario; the server takes
+// the list out of the patch on the way in. After that, draws and returns go
+// through bagDraw and bagInsert. What the pools encode to still counts
+// towards Limits.MaxStateBytes, as if they were in g.Data.
+
+// maxBagItems bounds one bag's contents, and maxBags how many bags a table
+// may have.
+const (
+	maxBagItems = 1000
+	maxBags     = 100
+)
+
+// The kinds of piece a bag holds, with the radius each spawns at, and a new
+// counter's maximum — as the client's piece defaults have them.
+var bagItemRadius = map[string]float64{
+	"token":   0.75,
+	"pawn":    0.3,
+	"counter": 0.6,
+}
+
+const counterMaxDefault = 20.0
+
+// bagContents takes the contents of the bags in pieces — a patch's, or a
+// whole state's — out of it, leaving each bag a count instead. before is
+// the pieces the patch lands on, nil for a new state. Contents are only
+// taken from a bag as it is spawned: an existing bag's pool changes through
+// bagDraw and bagInsert alone, so contents written for one are dropped, as
+// they are for a bag turned into another kind of piece, whose pool goes
+// with it. It returns the new pools by bag id, the bags whose pools go, and
+// whether pieces was changed.
+func bagContents(before, pieces map[string]any) (pools map[string][]any, dropped []string, stripped bool, rej *rejection) {
+	pools = map[string][]any{}
+	for _, id := range sortedKeys(pieces) {
+		if pieces[id] == nil {
+			dropped = append(dropped, id)
+			continue
+		}
+		fields, ok := pieces[id].(map[string]any)
+		if !ok {
+			continue
+		}
+		old, _ := before[id].(map[string]any)
+		wasBag := old != nil && old["kind"] == "bag"
+		isBag := pick(fields, old, "kind") == "bag"
+		if !wasBag && !isBag {
+			continue
+		}
+		contents, hasContents := fields["contents"]
+		if hasContents {
+			delete(fields, "contents")
+			stripped = true
+		}
+		// the count is the server's to write
+		if _, ok := fields["count"]; ok {
+			delete(fields, "count")
+			stripped = true
+		}
+
+		switch {
+		case !isBag:
+			// no longer a bag: its pool and its count go
+			dropped = append(dropped, id)
+			fields["count"] = nil
+		case !wasBag:
+			// spawned, empty unless it came with contents
+			items, _ := contents.([]any)
+			if contents != nil && items == nil {
+				return nil, nil, false, &rejection{"invalid", fmt.Errorf("contents of %s must be a list", id)}
+			}
+			if len(items) > maxBagItems {
+				return nil, nil, false, &rejection{"invalid", fmt.Errorf("a bag holds at most %d items", maxBagItems)}
+			}
+			for _, item := range items {
+				fields, ok := item.(map[string]any)
+				if !ok {
+					return nil, nil, false, &rejection{"invalid", fmt.Errorf("items in %s must be objects", id)}
+				}
+				if err := checkBagItem(fields); err != nil {
+					return nil, nil, false, &rejection{"invalid", fmt.Errorf("%s: %w", id, err)}
+				}
+			}
+			if items == nil {
+				items = []any{}
+			}
+			pools[id] = items
+			fields["count"] = float64(len(items))
+			stripped = true
+		}
+		if len(fields) == 0 {
+			delete(pieces, id)
+		}
+	}
+	if len(pools) > maxBags {
+		return nil, nil, false, &rejection{"invalid", fmt.Errorf("a table holds at most %d bags", maxBags)}
+	}
+	return pools, dropped, stripped, nil
+}
+
+// checkBagItem reports why item could never be drawn, the checks
+// spawnItemLocked makes: an item that fails them would wedge a lifo or fifo
+// bag for good.
+func checkBagItem(item map[string]any) error {
+	kind, _ := item["kind"].(string)
+	if kind == "card" {
+		face, _ := item["face"].(string)
+		code, _ := item["code"].(string)
+		if face == "" || code == "" {
+			return errors.New("a card in a bag needs a code and a face")
+		}
+		return nil
+	}
+	if _, ok := bagItemRadius[kind]; !ok {
+		return fmt.Errorf("a bag cannot hold a %q", kind)
+	}
+	return nil
+}
+
+// setPoolLocked stores a bag's contents and what they encode to; dropPoolLocked
+// forgets both. Caller must hold g.mu.
+func (g *Game) setPoolLocked(id string, items []any) {
+	g.pools[id] = items
+	g.poolBytes[id] = encodedSize(items)
+}
+
+func (g *Game) dropPoolLocked(id string) {
+	delete(g.pools, id)
+	delete(g.poolBytes, id)
+}
+
+// poolBytesLocked is what every bag's contents encode to together. Caller
+// must hold g.mu.
+func (g *Game) poolBytesLocked() int {
+	total := 0
+	for _, n := range g.poolBytes {
+		total += n
+	}
+	return total
+}
+
+// encodedSize is the length of v as JSON.
+func encodedSize(v any) int {
+	data, _ := json.Marshal(v)
+	return len(data)
+}
+
+// bagPatchLocked applies bagContents to a client patch and returns the func
+// that stores the pools, to be called once the patch is merged, and what the
+// new pools encode to. Caller must hold g.mu.
+func (g *Game) bagPatchLocked(patch map[string]any) (commit func(), pooled int, stripped bool, rej *rejection) {
+	raw, ok := patch["pieces"]
+	if !ok {
+		return func() {}, 0, false, nil
+	}
+	if raw == nil {
+		// every piece goes, and every bag with them
+		return func() {
+			clear(g.pools)
+			clear(g.poolBytes)
+		}, 0, false, nil
+	}
+	pieces, ok := raw.(map[string]any)
+	if !ok {
+		return func() {}, 0, false, nil
+	}
+	pools, dropped, stripped, rej := bagContents(object(g.Data, "pieces"), pieces)
+	if rej != nil {
+		return nil, 0, false, rej
+	}
+	bags := len(g.pools)
+	for _, id := range dropped {
+		if _, ok := g.pools[id]; ok {
+			bags--
+		}
+	}
+	for id, items := range pools {
+		if _, ok := g.pools[id]; !ok {
+			bags++
+		}
+		pooled += encodedSize(items)
+	}
+	if bags > maxBags {
+		return nil, 0, false, &rejection{"invalid", fmt.Errorf("a table holds at most %d bags", maxBags)}
+	}
+	if len(pieces) == 0 {
+		delete(patch, "pieces")
+	}
+	return func() {
+		for _, id := range dropped {
+			g.dropPoolLocked(id)
+		}
+		for id, items := range pools {
+			g.setPoolLocked(id, items)
+		}
+	}, pooled, stripped, nil
+}
+
+// bagValue is the payload of bagDraw and bagInsert.
+type bagValue struct {
+	Bag string `json:"bag"`
+	// bagDraw: where a drawn piece lands, the bag's own position by default
+	// — the client knows the table's layout, the server does not — and where
+	// a drawn card does, Position by default
+	Position     []float64 `json:"position,omitempty"`
+	CardPosition []float64 `json:"cardPosition,omitempty"`
+	// bagInsert: the card or piece on the table to put in the bag
+	Entity string `json:"entity,omitempty"`
+}
+
+// bags handles bagDraw and bagInsert. Each resolves under g.mu and is
+// broadcast, to everyone, as one update: the bag's new count with the
+// spawned or removed entity, so no client ever sees an item in two places.
+func (g *Game) bags(from *Player, msg Message) {
+	var v bagValue
+	if msg.Value == nil || json.Unmarshal(msg.Value, &v) != nil {
+		g.sendError(from.ID, msg.Type, "invalid", "malformed "+msg.Type)
+		return
+	}
+
+	g.mu.Lock()
+	var (
+		patch map[string]any
+		line  logLine
+		err   *rejection
+	)
+	bag, ok := object(g.Data, "pieces")[v.Bag].(map[string]any)
+	switch {
+	case !ok || bag["kind"] != "bag":
+		err = &rejection{"unknown_piece", fmt.Errorf("no such bag: %s", v.Bag)}
+	case msg.Type == "bagDraw":
+		patch, line, err = g.bagDrawLocked(from, v, bag)
+	default:
+		patch, line, err = g.bagInsertLocked(from, v, bag)
+	}
+	if err != nil {
+		g.mu.Unlock()
+		g.sendError(from.ID, msg.Type, err.code, err.Error())
+		return
+	}
+	payload := g.mergeServerPatchLocked(from.ID, patch)
+	logged := g.recordLocked(from.ID, line)
+	g.LastActivity = time.Now()
+	g.mu.Unlock()
+
+	g.sendPresence(payload)
+	g.sendLog(logged)
+}
+
+// bagDrawLocked takes an item out of a bag, by its drawMode — lifo the last
+// one in, fifo the first, random (the default) any — and spawns it beside
+// the bag. An infinite bag keeps the item and hands out a copy. Caller must
+// hold g.mu.
+func (g *Game) bagDrawLocked(from *Player, v bagValue, bag map[string]any) (map[string]any, logLine, *rejection) {
+	items := g.pools[v.Bag]
+	if len(items) == 0 {
+		return nil, logLine{}, &rejection{"empty_bag", fmt.Errorf("%s is empty", v.Bag)}
+	}
+	if (v.Position != nil && len(v.Position) != 3) || (v.CardPosition != nil && len(v.CardPosition) != 3) {
+		return nil, logLine{}, &rejection{"invalid", errors.New("positions must be [x, y, z]")}
+	}
+	var i int
+	switch mode, _ := bag["drawMode"].(string); mode {
+	case "lifo":
+		i = len(items) - 1
+	case "fifo":
+		i = 0
+	default:
+		i = g.dice(len(items)) - 1
+	}
+	item := items[i].(map[string]any)
+
+	position := bag["position"]
+	landing := v.Position
+	if item["kind"] == "card" && v.CardPosition != nil {
+		landing = v.CardPosition
+	}
+	if landing != nil {
+		position = []any{landing[0], landing[1], landing[2]}
+	}
+	owner := ownerOf(v.Bag)
+	if owner == "" {
+		owner = from.ID
+	}
+	bagName, _ := bag["name"].(string)
+	collection, id, entity, rej := g.spawnItemLocked(item, owner, slugify(bagName, "bag"), position)
+	if rej != nil {
+		return nil, logLine{}, rej
+	}
+
+	// the entity joins the table; from a finite bag, the item leaves the pool
+	infinite, _ := bag["infinite"].(bool)
+	freed := 0
+	if !infinite {
+		freed = encodedSize(item)
+	}
+	if !g.growthFitsLocked(encodedSize(entity), freed) {
+		g.rejectedUpdates++
+		return nil, logLine{}, &rejection{"state_too_large", ErrStateTooLarge}
+	}
+	if !infinite {
+		g.setPoolLocked(v.Bag, append(items[:i:i], items[i+1:]...))
+	}
+	patch := map[string]any{
+		"pieces": map[string]any{v.Bag: map[string]any{"count": float64(len(g.pools[v.Bag]))}},
+	}
+	if collection == "pieces" {
+		patch["pieces"].(map[string]any)[id] = entity
+	} else {
+		patch[collection] = map[string]any{id: entity}
+	}
+	return patch, logLine{"bag", fmt.Sprintf("%s drew from %s", from.ID, pieceName(v.Bag, bag, nil))}, nil
+}
+
+// spawnItemLocked builds the table entity a bag item becomes, with an id
+// made the way clients make them: card:<owner>:<bag>-<code> for a card,
+// face down, and piece:<owner>:<name>-<n> for a piece. Caller must hold g.mu.
+func (g *Game) spawnItemLocked(item map[string]any, owner, bagSlug string, position any) (collection, id string, entity map[string]any, rej *rejection) {
+	kind, _ := item["kind"].(string)
+	if kind == "card" {
+		face, _ := item["face"].(string)
+		code, _ := item["code"].(string)
+		if face == "" || code == "" {
+			return "", "", nil, &rejection{"invalid", errors.New("a card in a bag needs a code and a face")}
+		}
+		cards := object(g.Data, "cards")
+		id = fmt.Sprintf("card:%s:%s-%s", owner, bagSlug, code)
+		for n := 2; cards[id] != nil; n++ {
+			id = fmt.Sprintf("card:%s:%s-%s-%d", owner, bagSlug, code, n)
+		}
+		entity = map[string]any{
+			"faceImageUrl": face,
+			"position":     position,
+			// face down: the bag was hidden, so drawing reveals nothing
+			"rotation": []any{float64(180), float64(0), float64(0)},
+		}
+		if back, _ := item["back"].(string); back != "" {
+			entity["backImageUrl"] = back
+		}
+		if o, ok := item["orientation"]; ok {
+			entity["orientation"] = o
+		}
+		return "cards", id, entity, nil
+	}
+
+	radius, ok := bagItemRadius[kind]
+	if !ok {
+		return "", "", nil, &rejection{"invalid", fmt.Errorf("cannot draw a %q from a bag", kind)}
+	}
+	name, _ := item["name"].(string)
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = strings.ToUpper(kind[:1]) + kind[1:]
+	}
+	pieces := object(g.Data, "pieces")
+	slug := slugify(name, kind)
+	for n := 0; ; n++ {
+		id = fmt.Sprintf("piece:%s:%s-%d", owner, slug, n)
+		if pieces[id] == nil {
+			break
+		}
+	}
+	entity = map[string]any{
+		"kind":     kind,
+		"name":     name,
+		"position": position,
+		"rotation": []any{float64(0), float64(0), float64(0)},
+		"radius":   radius,
+	}
+	if r, ok := item["radius"].(float64); ok {
+		entity["radius"] = r
+	}
+	for _, k := range []string{"color", "imageUrl"} {
+		if s, _ := item[k].(string); s != "" {
+			entity[k] = s
+		}
+	}
+	if kind == "counter" {
+		maxValue, ok := item["maxValue"].(float64)
+		if !ok {
+			maxValue = counterMaxDefault
+		}
+		entity["maxValue"] = maxValue
+		entity["value"] = maxValue
+	}
+	return "pieces", id, entity, nil
+}
+
+// bagInsertLocked puts a card or piece from the table into a bag, at the end
+// of its contents. Bags, dice and models stay out: an item has nowhere to
+// keep what makes them what they are. Caller must hold g.mu.
+func (g *Game) bagInsertLocked(from *Player, v bagValue, bag map[string]any) (map[string]any, logLine, *rejection) {
+	if len(g.pools[v.Bag]) >= maxBagItems {
+		return nil, logLine{}, &rejection{"invalid", fmt.Errorf("a bag holds at most %d items", maxBagItems)}
+	}
+	var (
+		item   map[string]any
+		what   string
+		entity map[string]any
+		patch  = map[string]any{}
+	)
+	if piece, ok := object(g.Data, "pieces")[v.Entity].(map[string]any); ok {
+		kind, _ := piece["kind"].(string)
+		if _, ok := bagItemRadius[kind]; !ok {
+			return nil, logLine{}, &rejection{"invalid", fmt.Errorf("a %s cannot go in a bag", kind)}
+		}
+		item = map[string]any{"kind": kind}
+		for _, k := range []string{"name", "color", "imageUrl", "radius", "maxValue"} {
+			if value, ok := piece[k]; ok {
+				item[k] = value
+			}
+		}
+		what, entity = pieceName(v.Entity, piece, nil), piece
+		patch["pieces"] = map[string]any{v.Entity: nil}
+	} else if card, ok := object(g.Data, "cards")[v.Entity].(map[string]any); ok {
+		face, _ := card["faceImageUrl"].(string)
+		if face == "" {
+			return nil, logLine{}, &rejection{"invalid", fmt.Errorf("%s has no face", v.Entity)}
+		}
+		// the slug half of card:<owner>:<slug> is what a draw builds its id
+		// from again
+		_, code, _ := strings.Cut(strings.TrimPrefix(v.Entity, "card:"), ":")
+		if code == "" {
+			code = "card"
+		}
+		item = map[string]any{"kind": "card", "code": code, "face": face}
+		if back, _ := card["backImageUrl"].(string); back != "" {
+			item["back"] = back
+		}
+		if o, ok := card["orientation"]; ok {
+			item["orientation"] = o
+		}
+		what, entity = "a card", card
+		patch["cards"] = map[string]any{v.Entity: nil}
+	} else {
+		return nil, logLine{}, &rejection{"unknown_piece", fmt.Errorf("nothing on the table called %s", v.Entity)}
+	}
+
+	if err := checkBagItem(item); err != nil {
+		return nil, logLine{}, &rejection{"invalid", err}
+	}
+	// the item joins the pool as the entity leaves the table
+	if !g.growthFitsLocked(encodedSize(item), encodedSize(entity)) {
+		g.rejectedUpdates++
+		return nil, logLine{}, &rejection{"state_too_large", ErrStateTooLarge}
+	}
+	g.setPoolLocked(v.Bag, append(g.pools[v.Bag], item))
+	pieces, _ := patch["pieces"].(map[string]any)
+	if pieces == nil {
+		pieces = map[string]any{}
+		patch["pieces"] = pieces
+	}
+	pieces[v.Bag] = map[string]any{"count": float64(len(g.pools[v.Bag]))}
+	return patch, logLine{"bag", fmt.Sprintf("%s put %s into %s", from.ID, what, pieceName(v.Bag, bag, nil))}, nil
+}
+
+// ownerOf is the owner segment of a kind:owner:slug id.
+func ownerOf(id string) string {
+	parts := strings.SplitN(id, ":", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// slugify is a name as ids carry it: lower case, runs of anything but
+// letters and digits turned into one dash, none at either end.
+func slugify(name, fallback string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+			continue
+		}
+		dash = true
+	}
+	if b.Len() == 0 {
+		return fallback
+	}
+	return b.String()
+}
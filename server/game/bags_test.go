@@ -0,0 +1,224 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func pieceRow(t *testing.T, g *Game, id string) map[string]any {
+	t.Helper()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	row, _ := object(g.Data, "pieces")[id].(map[string]any)
+	return row
+}
+
+const bagPatch = `{"pieces":{"piece:alice:bag-0":{"kind":"bag","name":"Bag","position":[1,0,2],"drawMode":"%s"%s,
+	"contents":[{"kind":"token","name":"Gold"},{"kind":"card","code":"ace","face":"ace.png"},{"kind":"counter","name":"HP","maxValue":10}]}}}`
+
+func bagGame(t *testing.T, mode, extra string) (*Game, <-chan *PlayerMessage, *Player) {
+	t.Helper()
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RolePlayer)
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(fmt.Sprintf(bagPatch, mode, extra))})
+	drain(out)
+	return g, out, alice
+}
+
+func TestBagContentsNeverReachTheWire(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(fmt.Sprintf(bagPatch, "random", ""))})
+	_, m := nextOfType(t, out, "update")
+	require.NotContains(t, string(m.Value), "ace.png", "the relay carries the count, not the pool")
+	require.Contains(t, string(m.Value), `"count":3`)
+	require.NotContains(t, pieceRow(t, g, "piece:alice:bag-0"), "contents")
+
+	// nor can a client set the count itself
+	g.HandleMessage(bob, Message{Type: "update", Value: json.RawMessage(`{"pieces":{"piece:alice:bag-0":{"count":99}}}`)})
+	require.Equal(t, float64(3), pieceRow(t, g, "piece:alice:bag-0")["count"])
+
+	require.NoError(t, g.Reset(map[string]any{"pieces": map[string]any{
+		"piece:alice:bag-0": map[string]any{"kind": "bag", "contents": []any{map[string]any{"kind": "pawn"}}},
+	}}))
+	_, m = nextOfType(t, out, "sync")
+	require.NotContains(t, string(m.Value), "contents")
+	require.Equal(t, float64(1), pieceRow(t, g, "piece:alice:bag-0")["count"])
+}
+
+func TestBagDrawsFollowTheDrawMode(t *testing.T) {
+	g, out, alice := bagGame(t, "lifo", "")
+	draw := func() {
+		g.HandleMessage(alice, Message{Type: "bagDraw", Value: json.RawMessage(`{"bag":"piece:alice:bag-0","position":[3,0.1,4]}`)})
+	}
+
+	draw()
+	pm, m := nextOfType(t, out, "update")
+	require.Empty(t, pm.To)
+	require.JSONEq(t, `{"pieces":{
+		"piece:alice:bag-0":{"count":2},
+		"piece:alice:hp-0":{"kind":"counter","name":"HP","position":[3,0.1,4],"rotation":[0,0,0],"radius":0.6,"maxValue":10,"value":10}
+	}}`, string(m.Value))
+	require.Contains(t, logTexts(g), "alice drew from Bag")
+
+	draw()
+	_, m = nextOfType(t, out, "update")
+	require.JSONEq(t, `{"pieces":{"piece:alice:bag-0":{"count":1}},"cards":{
+		"card:alice:bag-ace":{"faceImageUrl":"ace.png","position":[3,0.1,4],"rotation":[180,0,0]}
+	}}`, string(m.Value), "a card comes out face down")
+
+	draw()
+	draw()
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "empty_bag", errorCode(t, m))
+	require.NotNil(t, pieceRow(t, g, "piece:alice:gold-0"))
+
+	g, out, alice = bagGame(t, "fifo", "")
+	g.HandleMessage(alice, Message{Type: "bagDraw", Value: json.RawMessage(`{"bag":"piece:alice:bag-0"}`)})
+	_, m = nextOfType(t, out, "update")
+	require.Contains(t, string(m.Value), `"piece:alice:gold-0":{`)
+	require.Contains(t, string(m.Value), `"position":[1,0,2]`, "without a position it lands on the bag")
+
+	g, out, alice = bagGame(t, "random", "")
+	g.dice = loaded(t, 2)
+	g.HandleMessage(alice, Message{Type: "bagDraw", Value: json.RawMessage(`{"bag":"piece:alice:bag-0"}`)})
+	_, m = nextOfType(t, out, "update")
+	require.Contains(t, string(m.Value), `"card:alice:bag-ace"`)
+}
+
+func TestInfiniteBagNeverEmpties(t *testing.T) {
+	g, out, alice := bagGame(t, "fifo", `,"infinite":true`)
+	for range 3 {
+		g.HandleMessage(alice, Message{Type: "bagDraw", Value: json.RawMessage(`{"bag":"piece:alice:bag-0"}`)})
+	}
+	drain(out)
+	require.Equal(t, float64(3), pieceRow(t, g, "piece:alice:bag-0")["count"])
+	for _, id := range []string{"piece:alice:gold-0", "piece:alice:gold-1", "piece:alice:gold-2"} {
+		require.NotNil(t, pieceRow(t, g, id), id)
+	}
+}
+
+func TestBagInsertTakesTheEntityOffTheTable(t *testing.T) {
+	g, out, alice := bagGame(t, "lifo", "")
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(
+		`{"cards":{"card:bob:king":{"faceImageUrl":"king.png","position":[0,0,0],"rotation":[0,0,0]}},"pieces":{"piece:bob:d6-0":{"kind":"die","sides":6}}}`)})
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "bagInsert", Value: json.RawMessage(`{"bag":"piece:alice:bag-0","entity":"card:bob:king"}`)})
+	_, m := nextOfType(t, out, "update")
+	require.JSONEq(t, `{"cards":{"card:bob:king":null},"pieces":{"piece:alice:bag-0":{"count":4}}}`, string(m.Value))
+	require.Contains(t, logTexts(g), "alice put a card into Bag")
+
+	// lifo: what went in last comes out first, under the id it went in with
+	g.HandleMessage(alice, Message{Type: "bagDraw", Value: json.RawMessage(`{"bag":"piece:alice:bag-0"}`)})
+	_, m = nextOfType(t, out, "update")
+	require.Contains(t, string(m.Value), `"card:alice:bag-king":{"faceImageUrl":"king.png"`)
+
+	g.HandleMessage(alice, Message{Type: "bagInsert", Value: json.RawMessage(`{"bag":"piece:alice:bag-0","entity":"piece:bob:d6-0"}`)})
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "invalid", errorCode(t, m), "a die has no bag item")
+	g.HandleMessage(alice, Message{Type: "bagInsert", Value: json.RawMessage(`{"bag":"piece:bob:d6-0","entity":"card:alice:bag-king"}`)})
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "unknown_piece", errorCode(t, m), "only bags take items")
+}
+
+func TestSlugifyMatchesTheClient(t *testing.T) {
+	require.Equal(t, "gold-coin", slugify("  Gold  Coin! ", "token"))
+	require.Equal(t, "token", slugify("!!", "token"))
+	require.Equal(t, "alice", ownerOf("piece:alice:bag-0"))
+}
+
+func TestContentsOnlyFillABagAsItIsSpawned(t *testing.T) {
+	g, out, alice := bagGame(t, "fifo", "")
+
+	// the old client's return: the bag's contents as it saw them plus one
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(
+		`{"pieces":{"piece:alice:bag-0":{"contents":[{"kind":"pawn","name":"Intruder"}],"position":[5,0,5]}}}`)})
+	_, m := nextOfType(t, out, "update")
+	require.JSONEq(t, `{"pieces":{"piece:alice:bag-0":{"position":[5,0,5]}}}`, string(m.Value))
+	require.Equal(t, float64(3), pieceRow(t, g, "piece:alice:bag-0")["count"])
+	g.mu.Lock()
+	require.Len(t, g.pools["piece:alice:bag-0"], 3, "the pool is untouched")
+	g.mu.Unlock()
+
+	// a bag that becomes a token takes its pool and its count with it
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(
+		`{"pieces":{"piece:alice:bag-0":{"kind":"token","contents":[{"kind":"pawn"}]}}}`)})
+	drain(out)
+	require.NotContains(t, pieceRow(t, g, "piece:alice:bag-0"), "count")
+	require.NotContains(t, pieceRow(t, g, "piece:alice:bag-0"), "contents")
+	g.mu.Lock()
+	require.NotContains(t, g.pools, "piece:alice:bag-0")
+	g.mu.Unlock()
+}
+
+func TestBagsCountTowardsTheStateSizeCap(t *testing.T) {
+	g, out := NewGame(Config{Limits: Limits{MaxStateBytes: 2048}})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(fmt.Sprintf(bagPatch, "fifo", `,"infinite":true`))})
+	drain(out)
+
+	// an infinite bag stops handing out copies at the cap
+	refused := false
+	for range 200 {
+		g.HandleMessage(alice, Message{Type: "bagDraw", Value: json.RawMessage(`{"bag":"piece:alice:bag-0"}`)})
+		pm := <-out
+		var m Message
+		require.NoError(t, json.Unmarshal(pm.Content, &m))
+		if m.Type == "error" {
+			require.Equal(t, "state_too_large", errorCode(t, m))
+			refused = true
+			break
+		}
+		drain(out)
+	}
+	require.True(t, refused)
+	g.mu.Lock()
+	data, _ := json.Marshal(g.Data)
+	size := len(data) + g.poolBytesLocked()
+	g.mu.Unlock()
+	require.LessOrEqual(t, size, 2048)
+
+	// and a bag cannot bring in more than the table has room for
+	contents := `{"kind":"token","name":"` + strings.Repeat("x", 4096) + `"}`
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(
+		`{"pieces":{"piece:alice:bag-1":{"kind":"bag","contents":[` + contents + `]}}}`)})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "state_too_large", errorCode(t, m))
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	require.NotContains(t, g.pools, "piece:alice:bag-1")
+}
+
+func TestBagRefusesItemsItCouldNeverDraw(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	drain(out)
+
+	for _, item := range []string{`{"kind":"card","code":"ace"}`, `{"kind":"dragon"}`, `{}`} {
+		g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(
+			`{"pieces":{"piece:alice:bag-0":{"kind":"bag","drawMode":"lifo","contents":[` + item + `]}}}`)})
+		_, m := nextOfType(t, out, "error")
+		require.Equal(t, "invalid", errorCode(t, m), item)
+		require.Nil(t, pieceRow(t, g, "piece:alice:bag-0"), item)
+	}
+
+	// nor may a table hold more than maxBags bags
+	pieces := map[string]any{}
+	for i := range maxBags + 1 {
+		pieces[fmt.Sprintf("piece:alice:bag-%d", i)] = map[string]any{"kind": "bag"}
+	}
+	patch, _ := json.Marshal(map[string]any{"pieces": pieces})
+	g.HandleMessage(alice, Message{Type: "update", Value: patch})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "invalid", errorCode(t, m))
+	require.Error(t, g.Reset(map[string]any{"pieces": pieces}))
+}
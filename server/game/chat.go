@@ -0,0 +1,114 @@
+package game
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ChatMessage is one line of lobby chat. To is set for a whisper, which only
+// the two players involved ever see.
+type ChatMessage struct {
+	ID        int64  `json:"id"`
+	From      string `json:"from"`
+	To        string `json:"to,omitempty"`
+	Text      string `json:"text"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// chatValue is the payload of a chat message from a client.
+type chatValue struct {
+	Text string `json:"text"`
+	To   string `json:"to,omitempty"`
+}
+
+// visibleTo reports whether player id may see m.
+func (m ChatMessage) visibleTo(id string) bool {
+	return m.To == "" || m.To == id || m.From == id
+}
+
+// chat stamps a client's chat line, keeps it in the lobby's bounded history
+// and delivers it: to everyone, or as a whisper to the recipient and the
+// sender. The sender always gets the stamped line back. Chat lives outside
+// g.Data, so it never rides along in a sync.
+func (g *Game) chat(from *Player, msg Message) {
+	var v chatValue
+	if msg.Value == nil || json.Unmarshal(msg.Value, &v) != nil {
+		g.sendError(from.ID, msg.Type, "invalid", "chat needs a text")
+		return
+	}
+	v.Text = strings.TrimSpace(v.Text)
+	if v.Text == "" {
+		g.sendError(from.ID, msg.Type, "invalid", "chat needs a text")
+		return
+	}
+	if utf8.RuneCountInString(v.Text) > g.chatLength {
+		g.sendError(from.ID, msg.Type, "invalid", "chat message is too long")
+		return
+	}
+
+	now := time.Now()
+	g.mu.Lock()
+	if v.To != "" {
+		if _, ok := g.Players[v.To]; !ok {
+			g.mu.Unlock()
+			g.sendError(from.ID, msg.Type, "unknown_player", "no such player: "+v.To)
+			return
+		}
+	}
+	g.chatSeq++
+	line := ChatMessage{
+		ID:        g.chatSeq,
+		From:      from.ID,
+		To:        v.To,
+		Text:      v.Text,
+		Timestamp: now.UnixMilli(),
+	}
+	if len(g.chatLog) == g.chatHistory {
+		copy(g.chatLog, g.chatLog[1:])
+		g.chatLog = g.chatLog[:len(g.chatLog)-1]
+	}
+	g.chatLog = append(g.chatLog, line)
+	g.LastActivity = now
+	g.mu.Unlock()
+
+	value, _ := json.Marshal(line)
+	payload, _ := json.Marshal(Message{
+		Type:      "chat",
+		PlayerID:  from.ID,
+		Timestamp: line.Timestamp,
+		Value:     value,
+	})
+	to := []string{}
+	if v.To != "" {
+		to = []string{v.To, from.ID}
+	}
+	g.send(&PlayerMessage{To: to, Content: payload, Type: "chat"})
+}
+
+// ReplayChat sends a joining player the chat history they may see, as one
+// chatHistory message. Call it after their sync; nothing is sent when there
+// is no history.
+func (g *Game) ReplayChat(id string) {
+	g.mu.Lock()
+	lines := make([]ChatMessage, 0, len(g.chatLog))
+	for _, m := range g.chatLog {
+		if m.visibleTo(id) {
+			lines = append(lines, m)
+		}
+	}
+	g.mu.Unlock()
+	if len(lines) == 0 {
+		return
+	}
+
+	value, _ := json.Marshal(map[string]any{"messages": lines})
+	payload, _ := json.Marshal(Message{
+		Type:      "chatHistory",
+		PlayerID:  id,
+		Timestamp: time.Now().UnixMilli(),
+		Value:     value,
+	})
+	g.send(&PlayerMessage{To: []string{id}, Content: payload, Type: "chatHistory"})
+}
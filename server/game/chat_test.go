@@ -0,0 +1,112 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func chatLine(t *testing.T, m Message) ChatMessage {
+	t.Helper()
+	var line ChatMessage
+	require.NoError(t, json.Unmarshal(m.Value, &line))
+	return line
+}
+
+func TestChatBroadcastsToEveryoneIncludingSender(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "chat", Value: json.RawMessage(`{"text":"  gg  "}`)})
+	pm, m := nextOfType(t, out, "chat")
+	require.Empty(t, pm.To)
+	require.Empty(t, pm.Exclude, "the sender gets the stamped line back")
+	line := chatLine(t, m)
+	require.Equal(t, "alice", line.From)
+	require.Equal(t, "gg", line.Text)
+	require.Equal(t, int64(1), line.ID)
+
+	g.mu.Lock()
+	require.NotContains(t, g.Data, "chat", "chat never rides along in a sync")
+	g.mu.Unlock()
+}
+
+func TestWhisperReachesOnlyBothPlayers(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "chat", Value: json.RawMessage(`{"text":"psst","to":"bob"}`)})
+	pm, m := nextOfType(t, out, "chat")
+	require.ElementsMatch(t, []string{"alice", "bob"}, pm.To)
+	require.Equal(t, "bob", chatLine(t, m).To)
+
+	g.HandleMessage(alice, Message{Type: "chat", Value: json.RawMessage(`{"text":"psst","to":"nobody"}`)})
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "unknown_player", errorCode(t, m))
+}
+
+func TestChatRejectsEmptyAndOverlongLines(t *testing.T) {
+	g, out := NewGame(Config{ChatLength: 5})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	drain(out)
+
+	for _, value := range []string{`{"text":"   "}`, `{"text":"toolong"}`, `"not an object"`} {
+		g.HandleMessage(alice, Message{Type: "chat", Value: json.RawMessage(value)})
+		_, m := nextOfType(t, out, "error")
+		require.Equal(t, "invalid", errorCode(t, m), value)
+	}
+	// five characters, more bytes
+	g.HandleMessage(alice, Message{Type: "chat", Value: json.RawMessage(`{"text":"héllo"}`)})
+	nextOfType(t, out, "chat")
+}
+
+func TestSpectatorsMayChat(t *testing.T) {
+	g, out := NewGame(Config{})
+	mustConnect(t, g, "alice", RolePlayer)
+	watcher := mustConnect(t, g, "watcher", RoleSpectator)
+	drain(out)
+
+	g.HandleMessage(watcher, Message{Type: "chat", Value: json.RawMessage(`{"text":"nice play"}`)})
+	_, m := nextOfType(t, out, "chat")
+	require.Equal(t, "watcher", chatLine(t, m).From)
+}
+
+func TestReplayChatIsBoundedAndHidesOthersWhispers(t *testing.T) {
+	g, out := NewGame(Config{ChatHistory: 3})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	mustConnect(t, g, "carol", RolePlayer)
+	drain(out)
+
+	for i := 1; i <= 3; i++ {
+		g.HandleMessage(alice, Message{Type: "chat", Value: json.RawMessage(fmt.Sprintf(`{"text":"line %d"}`, i))})
+	}
+	g.HandleMessage(bob, Message{Type: "chat", Value: json.RawMessage(`{"text":"secret","to":"alice"}`)})
+	drain(out)
+
+	replay := func(id string) []string {
+		g.ReplayChat(id)
+		pm, m := nextOfType(t, out, "chatHistory")
+		require.Equal(t, []string{id}, pm.To)
+		var v struct{ Messages []ChatMessage }
+		require.NoError(t, json.Unmarshal(m.Value, &v))
+		var texts []string
+		for _, line := range v.Messages {
+			texts = append(texts, line.Text)
+		}
+		return texts
+	}
+	// the oldest line fell out of the three kept
+	require.Equal(t, []string{"line 2", "line 3", "secret"}, replay("alice"))
+	require.Equal(t, []string{"line 2", "line 3"}, replay("carol"))
+
+	fresh, out := NewGame(Config{})
+	fresh.ReplayChat("alice")
+	require.Empty(t, out, "nothing to replay, nothing sent")
+}
@@ -0,0 +1,298 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jollygrin/tts-server/clock"
+	"github.com/rs/zerolog/log"
+)
+
+// clockState is the lobby's game clocks: each player's remaining time, with
+// at most one clock running, chess-style. The server is the only one
+// counting: g.Data["clocks"] is broadcast as a clock starts, stops or runs
+// out, and re-broadcast every clockTick while one runs, with the server time
+// it was taken at and the running clock's deadline, so clients count down
+// smoothly in between and correct for drift on every tick.
+type clockState struct {
+	remaining map[string]time.Duration
+	// whose clock is counting down, "" when none, and since when remaining
+	// was last brought up to date
+	running string
+	since   time.Time
+	// whose clock pauseClock stopped, for resumeClock
+	paused string
+	// players whose clocks setClocks dropped, nulled in the next patch
+	removed []string
+
+	// bumped whenever the timers are rescheduled, so a timer that fires
+	// after being replaced does nothing
+	gen          int
+	expiry, tick clock.Timer
+}
+
+// settle charges the running clock for the time since it was last settled.
+func (cs *clockState) settle(now time.Time) {
+	if cs.running == "" {
+		return
+	}
+	cs.remaining[cs.running] = max(cs.remaining[cs.running]-now.Sub(cs.since), 0)
+	cs.since = now
+}
+
+func (cs *clockState) stopTimers() {
+	if cs.expiry != nil {
+		cs.expiry.Stop()
+		cs.tick.Stop()
+		cs.expiry, cs.tick = nil, nil
+	}
+}
+
+// value is cs as it sits in g.Data: remaining times in milliseconds as of
+// at, and while a clock runs, the server time it runs out (a null in a patch
+// removes it).
+func (cs *clockState) value(now time.Time) map[string]any {
+	remaining := make(map[string]any, len(cs.remaining))
+	for id, d := range cs.remaining {
+		remaining[id] = float64(d.Milliseconds())
+	}
+	var deadline any
+	if cs.running != "" {
+		deadline = float64(now.Add(cs.remaining[cs.running]).UnixMilli())
+	}
+	return map[string]any{
+		"remaining": remaining,
+		"running":   cs.running,
+		"paused":    cs.paused != "",
+		"at":        float64(now.UnixMilli()),
+		"deadline":  deadline,
+	}
+}
+
+// clockValue is the payload of the clock messages; each reads only its
+// fields.
+type clockValue struct {
+	// setClocks: each player's time, in milliseconds
+	Remaining map[string]int64 `json:"remaining,omitempty"`
+	// startClock: whose clock to start
+	Player string `json:"player,omitempty"`
+}
+
+// clocks handles setClocks, startClock, stopClock, pauseClock and
+// resumeClock. Setting, pausing and resuming are the host's. A clock is
+// started by the host, by the player whose clock is running — hitting the
+// clock hands it on — or, when none runs, by its own player; stopping is
+// the host's or the running player's.
+func (g *Game) clocks(from *Player, msg Message) {
+	var v clockValue
+	if msg.Value != nil && json.Unmarshal(msg.Value, &v) != nil {
+		g.sendError(from.ID, msg.Type, "invalid", "malformed "+msg.Type)
+		return
+	}
+
+	g.mu.Lock()
+	now := g.clock.Now()
+	var (
+		line logLine
+		err  *rejection
+	)
+	if msg.Type == "setClocks" {
+		line, err = g.setClocksLocked(from, v.Remaining)
+	} else if g.clockState == nil {
+		err = &rejection{"no_clocks", errors.New("no clocks are set")}
+	} else {
+		cs := g.clockState
+		cs.settle(now)
+		switch msg.Type {
+		case "startClock":
+			line, err = g.startClockLocked(from, v.Player, now)
+		case "stopClock":
+			if from.ID != cs.running && from.Role != RoleHost {
+				err = &rejection{"forbidden", errors.New("only the host or the running player can stop the clock")}
+				break
+			}
+			if cs.running != "" {
+				line = logLine{"clock", fmt.Sprintf("%s stopped %s's clock", from.ID, cs.running)}
+			}
+			cs.running = ""
+		case "pauseClock":
+			if cs.running != "" {
+				cs.paused, cs.running = cs.running, ""
+				line = logLine{"clock", from.ID + " paused the clocks"}
+			}
+		case "resumeClock":
+			if cs.paused != "" {
+				cs.running, cs.paused, cs.since = cs.paused, "", now
+				line = logLine{"clock", from.ID + " resumed the clocks"}
+			}
+		}
+	}
+	if err != nil {
+		g.mu.Unlock()
+		g.sendError(from.ID, msg.Type, err.code, err.Error())
+		return
+	}
+	payload := g.clockChangedLocked(from.ID, now)
+	var logged []byte
+	if line.text != "" {
+		logged = g.recordLocked(from.ID, line)
+	}
+	g.LastActivity = time.Now()
+	g.mu.Unlock()
+
+	g.sendPresence(payload)
+	g.sendLog(logged)
+}
+
+func (g *Game) setClocksLocked(from *Player, remaining map[string]int64) (logLine, *rejection) {
+	if len(remaining) == 0 {
+		return logLine{}, &rejection{"invalid", errors.New("setClocks needs each player's remaining time")}
+	}
+	for id, ms := range remaining {
+		if _, ok := g.Players[id]; !ok {
+			return logLine{}, &rejection{"unknown_player", fmt.Errorf("no such player: %s", id)}
+		}
+		if ms <= 0 {
+			return logLine{}, &rejection{"invalid", fmt.Errorf("%s needs a positive time", id)}
+		}
+	}
+	cs := &clockState{remaining: make(map[string]time.Duration, len(remaining))}
+	if old := g.clockState; old != nil {
+		old.stopTimers()
+		// carried over so a timer of the old set that already fired can
+		// never match the new one
+		cs.gen = old.gen
+		// clocks dropped from the new set must leave g.Data too
+		for id := range old.remaining {
+			if _, ok := remaining[id]; !ok {
+				cs.removed = append(cs.removed, id)
+			}
+		}
+	}
+	for id, ms := range remaining {
+		cs.remaining[id] = time.Duration(ms) * time.Millisecond
+	}
+	g.clockState = cs
+	return logLine{"clock", from.ID + " set the clocks"}, nil
+}
+
+func (g *Game) startClockLocked(from *Player, id string, now time.Time) (logLine, *rejection) {
+	cs := g.clockState
+	if id == "" {
+		return logLine{}, &rejection{"invalid", errors.New("startClock needs a player")}
+	}
+	if _, ok := cs.remaining[id]; !ok {
+		return logLine{}, &rejection{"unknown_player", fmt.Errorf("%s has no clock", id)}
+	}
+	allowed := from.Role == RoleHost || from.ID == cs.running || (cs.running == "" && from.ID == id)
+	if !allowed {
+		return logLine{}, &rejection{"forbidden", errors.New("it is not your clock to start")}
+	}
+	if cs.remaining[id] == 0 {
+		return logLine{}, &rejection{"invalid", fmt.Errorf("%s is out of time", id)}
+	}
+	var line logLine
+	if cs.running == "" {
+		// handing a running clock on is a chess move, not news
+		line = logLine{"clock", fmt.Sprintf("%s started %s's clock", from.ID, id)}
+	}
+	cs.running, cs.paused, cs.since = id, "", now
+	return line, nil
+}
+
+// clockChangedLocked reschedules the clock timers after a change and returns
+// the clocks patch to broadcast. Caller must hold g.mu.
+func (g *Game) clockChangedLocked(by string, now time.Time) []byte {
+	cs := g.clockState
+	cs.stopTimers()
+	cs.gen++
+	if cs.running != "" {
+		gen := cs.gen
+		cs.expiry = g.clock.AfterFunc(cs.remaining[cs.running], func() { g.clockExpired(gen) })
+		cs.tick = g.clock.AfterFunc(g.clockTick, func() { g.clockTicked(gen) })
+	}
+	value := cs.value(now)
+	for _, id := range cs.removed {
+		value["remaining"].(map[string]any)[id] = nil
+	}
+	cs.removed = nil
+	return g.mergeServerPatchLocked(by, map[string]any{"clocks": value})
+}
+
+// clockTicked re-broadcasts the running clock's authoritative remaining
+// time, so clients correct for drift and throttled tabs.
+func (g *Game) clockTicked(gen int) {
+	g.mu.Lock()
+	cs := g.clockState
+	if cs == nil || cs.gen != gen || g.closed() {
+		g.mu.Unlock()
+		return
+	}
+	now := g.clock.Now()
+	cs.settle(now)
+	cs.tick = g.clock.AfterFunc(g.clockTick, func() { g.clockTicked(gen) })
+	payload := g.mergeServerPatchLocked("", map[string]any{"clocks": cs.value(now)})
+	g.mu.Unlock()
+	g.sendPresence(payload)
+}
+
+// clockExpired stops a clock that ran out, and tells the lobby whose it was
+// with a clockExpired message.
+func (g *Game) clockExpired(gen int) {
+	g.mu.Lock()
+	cs := g.clockState
+	if cs == nil || cs.gen != gen || g.closed() {
+		g.mu.Unlock()
+		return
+	}
+	now := g.clock.Now()
+	who := cs.running
+	cs.settle(now)
+	cs.remaining[who] = 0
+	cs.running = ""
+	payload := g.clockChangedLocked("", now)
+	logged := g.recordLocked(who, logLine{"clock", who + " ran out of time"})
+	value, _ := json.Marshal(map[string]string{"player": who})
+	g.events.Publish(Event{Kind: EventClock, Type: "clockExpired", Player: who, Value: value})
+	expired, _ := json.Marshal(Message{
+		Type:      "clockExpired",
+		PlayerID:  who,
+		Timestamp: now.UnixMilli(),
+		Value:     value,
+	})
+	g.mu.Unlock()
+
+	g.sendPresence(payload)
+	// from a timer goroutine, so never block; the clocks patch above still
+	// shows the clock at zero if this is dropped
+	if !g.offer(&PlayerMessage{To: []string{}, Content: expired, Type: "clockExpired"}) {
+		log.Warn().Str("player", who).Msg("game out channel full, dropping clockExpired")
+	}
+	g.sendLog(logged)
+}
+
+// handClockLocked moves a running clock to the player whose turn it now is,
+// when they have one. Returns whether the clocks changed. Caller must hold
+// g.mu.
+func (g *Game) handClockLocked(to string, now time.Time) bool {
+	cs := g.clockState
+	if cs == nil || cs.running == "" || cs.running == to {
+		return false
+	}
+	if left, ok := cs.remaining[to]; !ok || left == 0 {
+		return false
+	}
+	cs.settle(now)
+	cs.running, cs.since = to, now
+	return true
+}
+
+// stopClocksLocked drops the clocks and their timers. Caller must hold g.mu.
+func (g *Game) stopClocksLocked() {
+	if g.clockState != nil {
+		g.clockState.stopTimers()
+		g.clockState = nil
+	}
+}
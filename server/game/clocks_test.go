@@ -0,0 +1,105 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jollygrin/tts-server/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func clocksRow(t *testing.T, g *Game) map[string]any {
+	t.Helper()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	clocks, _ := g.Data["clocks"].(map[string]any)
+	return clocks
+}
+
+func remainingMs(t *testing.T, g *Game, id string) any {
+	t.Helper()
+	return clocksRow(t, g)["remaining"].(map[string]any)[id]
+}
+
+func clockGame(t *testing.T) (*Game, <-chan *PlayerMessage, *clock.Fake, *Player, *Player) {
+	t.Helper()
+	fake := clock.NewFake(time.Unix(0, 0))
+	g, out := NewGame(Config{Clock: fake, ClockTick: 250 * time.Millisecond})
+	alice := mustConnect(t, g, "alice", RolePlayer) // host
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	g.HandleMessage(alice, Message{Type: "setClocks", Value: json.RawMessage(`{"remaining":{"alice":1000,"bob":1000}}`)})
+	drain(out)
+	return g, out, fake, alice, bob
+}
+
+func TestRunningClockIsChargedAndHandedOn(t *testing.T) {
+	g, out, fake, alice, bob := clockGame(t)
+
+	g.HandleMessage(alice, Message{Type: "startClock", Value: json.RawMessage(`{"player":"alice"}`)})
+	require.Equal(t, "alice", clocksRow(t, g)["running"])
+	fake.Advance(400 * time.Millisecond)
+	g.HandleMessage(alice, Message{Type: "startClock", Value: json.RawMessage(`{"player":"bob"}`)})
+	require.Equal(t, float64(600), remainingMs(t, g, "alice"))
+	require.Equal(t, "bob", clocksRow(t, g)["running"])
+
+	g.HandleMessage(bob, Message{Type: "stopClock"})
+	require.Equal(t, "", clocksRow(t, g)["running"])
+	fake.Advance(time.Second)
+	require.Equal(t, float64(1000), remainingMs(t, g, "bob"), "a stopped clock never expires")
+
+	// with no clock running, a player may only start their own
+	drain(out)
+	g.HandleMessage(bob, Message{Type: "startClock", Value: json.RawMessage(`{"player":"alice"}`)})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "forbidden", errorCode(t, m))
+}
+
+func TestRunningClockIsRebroadcastAndExpires(t *testing.T) {
+	g, out, fake, alice, _ := clockGame(t)
+	fake.Advance(time.Second)
+
+	g.HandleMessage(alice, Message{Type: "startClock", Value: json.RawMessage(`{"player":"bob"}`)})
+	_, m := nextOfType(t, out, "update")
+	var patch struct{ Clocks map[string]any }
+	require.NoError(t, json.Unmarshal(m.Value, &patch))
+	require.Equal(t, float64(1000), patch.Clocks["at"])
+	require.Equal(t, float64(2000), patch.Clocks["deadline"], "clients count down to it themselves")
+	drain(out)
+
+	// every tick re-broadcasts the time left, and the deadline holds
+	fake.Advance(250 * time.Millisecond)
+	_, m = nextOfType(t, out, "update")
+	require.NoError(t, json.Unmarshal(m.Value, &patch))
+	require.Equal(t, float64(750), patch.Clocks["remaining"].(map[string]any)["bob"])
+	require.Equal(t, float64(2000), patch.Clocks["deadline"])
+
+	fake.Advance(750 * time.Millisecond)
+	_, m = nextOfType(t, out, "clockExpired")
+	require.Equal(t, "bob", m.PlayerID)
+	require.Eventually(t, func() bool { return clocksRow(t, g)["running"] == "" }, time.Second, time.Millisecond)
+	require.Equal(t, float64(0), remainingMs(t, g, "bob"))
+	require.NotContains(t, clocksRow(t, g), "deadline", "a stopped clock has none")
+	require.Contains(t, logTexts(g), "bob ran out of time")
+}
+
+func TestPausedClocksDoNotRunAndFollowTheTurn(t *testing.T) {
+	g, out, fake, alice, _ := clockGame(t)
+	g.HandleMessage(alice, Message{Type: "setTurnOrder", Value: json.RawMessage(`{"order":["alice","bob"]}`)})
+	g.HandleMessage(alice, Message{Type: "startClock", Value: json.RawMessage(`{"player":"alice"}`)})
+	fake.Advance(100 * time.Millisecond)
+	g.HandleMessage(alice, Message{Type: "pauseClock"})
+	require.Equal(t, true, clocksRow(t, g)["paused"])
+	fake.Advance(5 * time.Second)
+	require.Equal(t, float64(900), remainingMs(t, g, "alice"))
+
+	g.HandleMessage(alice, Message{Type: "resumeClock"})
+	fake.Advance(100 * time.Millisecond)
+	g.HandleMessage(alice, Message{Type: "endTurn"})
+	require.Equal(t, "bob", clocksRow(t, g)["running"])
+	require.Equal(t, float64(800), remainingMs(t, g, "alice"))
+
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(`{"clocks":{"running":"alice"}}`)})
+	require.Equal(t, "bob", clocksRow(t, g)["running"], "clients never write the clocks")
+	drain(out)
+}
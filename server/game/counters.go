@@ -0,0 +1,168 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// maxCounter bounds every counter either side of 0, so a value stays a number
+// JSON and every client can hold exactly — one that overflowed to Inf could
+// never be marshaled again, and the lobby could never sync.
+const maxCounter = 1e9
+
+// counterValue is the payload of increment and decrement. It names either a
+// piece, whose value changes, or a player and a key in their metadata — a
+// life total, a resource pool. By defaults to 1. Min and max clamp the
+// result; a piece's maxValue is its max unless the message gives one, and a
+// metadata counter's is maxCounter.
+type counterValue struct {
+	Piece  string   `json:"piece,omitempty"`
+	Player string   `json:"player,omitempty"`
+	Key    string   `json:"key,omitempty"`
+	By     *float64 `json:"by,omitempty"`
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+}
+
+// counter handles increment and decrement. The change is read, applied and
+// merged under g.mu, so two players bumping the same counter at once both
+// count — a client patch of the new value is last-write-wins. The result is
+// broadcast to everyone, sender included, as an ordinary update.
+//
+// Any piece may be counted by a player; a player's metadata only by its
+// owner or the host, as with update.
+func (g *Game) counter(from *Player, msg Message) {
+	var v counterValue
+	if msg.Value == nil || json.Unmarshal(msg.Value, &v) != nil {
+		g.sendError(from.ID, msg.Type, "invalid", "malformed "+msg.Type)
+		return
+	}
+	by := 1.0
+	if v.By != nil {
+		by = *v.By
+	}
+	if by <= 0 || by > maxCounter {
+		g.sendError(from.ID, msg.Type, "invalid", fmt.Sprintf("%s needs an amount from 0 to %g", msg.Type, float64(maxCounter)))
+		return
+	}
+	if msg.Type == "decrement" {
+		by = -by
+	}
+	if v.Min != nil && v.Max != nil && *v.Min > *v.Max {
+		g.sendError(from.ID, msg.Type, "invalid", "min is greater than max")
+		return
+	}
+
+	g.mu.Lock()
+	var (
+		patch map[string]any
+		name  string
+		value float64
+		err   *rejection
+	)
+	switch {
+	case v.Piece != "" && v.Player == "":
+		patch, name, value, err = g.countPieceLocked(v, by)
+	case v.Player != "" && v.Key != "" && v.Piece == "":
+		patch, name, value, err = g.countMetadataLocked(from, v, by)
+	default:
+		err = &rejection{"invalid", errors.New(msg.Type + " needs a piece, or a player and a key")}
+	}
+	if err != nil {
+		g.mu.Unlock()
+		g.sendError(from.ID, msg.Type, err.code, err.Error())
+		return
+	}
+	payload := g.mergeServerPatchLocked(from.ID, patch)
+	logged := g.recordLocked(from.ID, logLine{"counter", fmt.Sprintf("%s set %s to %s", from.ID, name, number(value))})
+	g.LastActivity = time.Now()
+	g.mu.Unlock()
+
+	g.sendPresence(payload)
+	g.sendLog(logged)
+}
+
+func (g *Game) countPieceLocked(v counterValue, by float64) (map[string]any, string, float64, *rejection) {
+	piece, ok := object(g.Data, "pieces")[v.Piece].(map[string]any)
+	if !ok {
+		return nil, "", 0, &rejection{"unknown_piece", fmt.Errorf("no such piece: %s", v.Piece)}
+	}
+	current, rej := counted(piece["value"], v.Piece)
+	if rej != nil {
+		return nil, "", 0, rej
+	}
+	hi := v.Max
+	if hi == nil {
+		if m, ok := piece["maxValue"].(float64); ok {
+			hi = &m
+		}
+	}
+	value, rej := counterResult(current+by, v.Min, hi)
+	if rej != nil {
+		return nil, "", 0, rej
+	}
+	patch := map[string]any{"pieces": map[string]any{v.Piece: map[string]any{"value": value}}}
+	return patch, pieceName(v.Piece, piece, nil), value, nil
+}
+
+func (g *Game) countMetadataLocked(from *Player, v counterValue, by float64) (map[string]any, string, float64, *rejection) {
+	if v.Player != from.ID && from.Role != RoleHost {
+		return nil, "", 0, &rejection{"forbidden", errors.New("cannot modify another player's data: " + v.Player)}
+	}
+	if _, ok := g.Players[v.Player]; !ok {
+		return nil, "", 0, &rejection{"unknown_player", fmt.Errorf("no such player: %s", v.Player)}
+	}
+	row := object(object(g.Data, "players"), v.Player)
+	current, rej := counted(object(row, "metadata")[v.Key], v.Key)
+	if rej != nil {
+		return nil, "", 0, rej
+	}
+	hi := v.Max
+	if hi == nil {
+		m := float64(maxCounter)
+		hi = &m
+	}
+	value, rej := counterResult(current+by, v.Min, hi)
+	if rej != nil {
+		return nil, "", 0, rej
+	}
+	patch := map[string]any{"players": map[string]any{
+		v.Player: map[string]any{"metadata": map[string]any{v.Key: value}},
+	}}
+	return patch, v.Player + "'s " + v.Key, value, nil
+}
+
+// counted is a counter's current value; one never set counts from 0.
+func counted(v any, what string) (float64, *rejection) {
+	switch n := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return n, nil
+	default:
+		return 0, &rejection{"invalid", fmt.Errorf("%s is not a number", what)}
+	}
+}
+
+// counterResult clamps v and refuses a result outside ±maxCounter — from a
+// bound or a current value out of range — before it can reach g.Data.
+func counterResult(v float64, lo, hi *float64) (float64, *rejection) {
+	v = clamp(v, lo, hi)
+	if math.IsNaN(v) || math.Abs(v) > maxCounter {
+		return 0, &rejection{"out_of_range", fmt.Errorf("counters go from %g to %g", -float64(maxCounter), float64(maxCounter))}
+	}
+	return v, nil
+}
+
+func clamp(v float64, lo, hi *float64) float64 {
+	if hi != nil {
+		v = min(v, *hi)
+	}
+	if lo != nil {
+		v = max(v, *lo)
+	}
+	return v
+}
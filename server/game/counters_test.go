@@ -0,0 +1,117 @@
+package game
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func pieceValue(t *testing.T, g *Game, id string) any {
+	t.Helper()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return object(g.Data, "pieces")[id].(map[string]any)["value"]
+}
+
+func TestConcurrentIncrementsAllCount(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(`{"pieces":{"life":{"kind":"counter","name":"Life","value":20}}}`)})
+	drain(out)
+
+	var wg sync.WaitGroup
+	for _, p := range []*Player{alice, bob} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				g.HandleMessage(p, Message{Type: "increment", Value: json.RawMessage(`{"piece":"life"}`)})
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, float64(120), pieceValue(t, g, "life"))
+}
+
+func TestIncrementClampsAndBroadcastsTheResult(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(`{"pieces":{"life":{"kind":"counter","name":"Life","value":18,"maxValue":20}}}`)})
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "increment", Value: json.RawMessage(`{"piece":"life","by":5}`)})
+	pm, m := nextOfType(t, out, "update")
+	require.Empty(t, pm.To)
+	require.Empty(t, pm.Exclude, "the sender gets the result too")
+	require.JSONEq(t, `{"pieces":{"life":{"value":20}}}`, string(m.Value))
+	require.Contains(t, logTexts(g), "alice set Life to 20")
+
+	g.HandleMessage(alice, Message{Type: "decrement", Value: json.RawMessage(`{"piece":"life","by":30,"min":0}`)})
+	require.Equal(t, float64(0), pieceValue(t, g, "life"))
+	g.HandleMessage(alice, Message{Type: "increment", Value: json.RawMessage(`{"piece":"life","by":30,"max":25}`)})
+	require.Equal(t, float64(25), pieceValue(t, g, "life"), "a max in the message beats maxValue")
+
+	drain(out)
+	for _, bad := range []string{`{"piece":"life","by":0}`, `{"piece":"life","min":3,"max":1}`, `{"key":"life"}`} {
+		g.HandleMessage(alice, Message{Type: "increment", Value: json.RawMessage(bad)})
+		_, m = nextOfType(t, out, "error")
+		require.Equal(t, "invalid", errorCode(t, m), bad)
+	}
+	g.HandleMessage(alice, Message{Type: "increment", Value: json.RawMessage(`{"piece":"nope"}`)})
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "unknown_piece", errorCode(t, m))
+}
+
+func TestMetadataCountersBelongToTheirPlayer(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer) // host
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	watcher := mustConnect(t, g, "watcher", RoleSpectator)
+	drain(out)
+
+	g.HandleMessage(bob, Message{Type: "decrement", Value: json.RawMessage(`{"player":"bob","key":"mana","by":2}`)})
+	require.Equal(t, map[string]any{"mana": float64(-2)}, playerRow(t, g, "bob")["metadata"], "an unset counter starts at 0")
+
+	g.HandleMessage(bob, Message{Type: "increment", Value: json.RawMessage(`{"player":"alice","key":"mana"}`)})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "forbidden", errorCode(t, m))
+	g.HandleMessage(watcher, Message{Type: "increment", Value: json.RawMessage(`{"player":"watcher","key":"mana"}`)})
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "forbidden", errorCode(t, m))
+
+	g.HandleMessage(alice, Message{Type: "increment", Value: json.RawMessage(`{"player":"bob","key":"mana","by":5,"max":2}`)})
+	require.Equal(t, map[string]any{"mana": float64(2)}, playerRow(t, g, "bob")["metadata"])
+	require.Contains(t, logTexts(g), "alice set bob's mana to 2")
+}
+
+func TestCounterCannotOverflow(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(`{"pieces":{"huge":{"kind":"counter","value":1e308}}}`)})
+	drain(out)
+
+	for _, bad := range []string{`{"player":"alice","key":"life","by":1e308}`, `{"player":"alice","key":"life","by":2e9}`} {
+		g.HandleMessage(alice, Message{Type: "increment", Value: json.RawMessage(bad)})
+		_, m := nextOfType(t, out, "error")
+		require.Equal(t, "invalid", errorCode(t, m), bad)
+	}
+	for range 3 {
+		g.HandleMessage(alice, Message{Type: "increment", Value: json.RawMessage(`{"player":"alice","key":"life","by":1e9}`)})
+	}
+	require.Equal(t, map[string]any{"life": float64(maxCounter)}, playerRow(t, g, "alice")["metadata"], "metadata counters stop at their max")
+
+	g.HandleMessage(alice, Message{Type: "increment", Value: json.RawMessage(`{"piece":"huge","by":1e9}`)})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "out_of_range", errorCode(t, m))
+	g.HandleMessage(alice, Message{Type: "increment", Value: json.RawMessage(`{"player":"alice","key":"life","max":1e308}`)})
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "out_of_range", errorCode(t, m))
+
+	g.mu.Lock()
+	_, err := json.Marshal(g.Data)
+	g.mu.Unlock()
+	require.NoError(t, err, "the lobby can still sync")
+}
@@ -0,0 +1,270 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Bounds on one dice expression, so a roll stays something a table could
+// actually throw.
+const (
+	maxExprLength = 100
+	maxDice       = 100   // dice thrown across the whole expression, explosions included
+	maxSides      = 1000  // faces on one die
+	maxModifier   = 10000 // one flat term; with the length cap, the total can't overflow
+)
+
+// DiceTerm is one part of a rolled expression: a group of dice, or a flat
+// modifier with no dice.
+type DiceTerm struct {
+	// Expr is the term as written, without its sign: "4d6kh3", "2"
+	Expr string `json:"expr"`
+	// Sign is 1 or -1
+	Sign int `json:"sign"`
+	// Rolls are every die thrown, in order, explosions included; Kept are the
+	// ones that count. Both are empty for a modifier.
+	Rolls []int `json:"rolls,omitempty"`
+	Kept  []int `json:"kept,omitempty"`
+	// Value is what the term adds to the total, sign included.
+	Value int `json:"value"`
+}
+
+// RollResult is a resolved rollExpr, as broadcast in a roll message.
+type RollResult struct {
+	Expression string     `json:"expression"`
+	Roller     string     `json:"roller"`
+	Terms      []DiceTerm `json:"terms"`
+	Total      int        `json:"total"`
+	Timestamp  int64      `json:"timestamp"`
+}
+
+// diceGroup is a parsed NdS term.
+type diceGroup struct {
+	count, sides int
+	explode      bool
+	// keep > 0 keeps that many of the highest (or, with lowest, the lowest)
+	keep   int
+	lowest bool
+}
+
+// parsedTerm is one signed term of an expression: a dice group, or a
+// modifier when dice is nil.
+type parsedTerm struct {
+	expr     string
+	sign     int
+	dice     *diceGroup
+	modifier int
+}
+
+// parseDiceExpr parses expressions like "4d6kh3+2", "2d10", "d20-1" or
+// "3d6!": terms joined by + and -, each a flat number or NdS with an
+// optional ! to explode (a die showing its highest face is rolled again and
+// added) and khK/klK to keep the K highest or lowest dice. N defaults to 1.
+// Spaces are ignored and letters may be either case.
+func parseDiceExpr(s string) ([]parsedTerm, error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), ""))
+	if s == "" {
+		return nil, errors.New("empty expression")
+	}
+	if len(s) > maxExprLength {
+		return nil, fmt.Errorf("expression longer than %d characters", maxExprLength)
+	}
+
+	var terms []parsedTerm
+	dice := 0
+	for rest, sign := s, 1; rest != ""; {
+		switch rest[0] {
+		case '+':
+			sign, rest = 1, rest[1:]
+		case '-':
+			sign, rest = -1, rest[1:]
+		default:
+			if terms != nil {
+				return nil, fmt.Errorf("expected + or - before %q", rest)
+			}
+		}
+		end := strings.IndexAny(rest, "+-")
+		if end < 0 {
+			end = len(rest)
+		}
+		text := rest[:end]
+		rest = rest[end:]
+		if text == "" {
+			return nil, errors.New("missing term after a sign")
+		}
+
+		term := parsedTerm{expr: text, sign: sign}
+		if !strings.Contains(text, "d") {
+			n, err := strconv.Atoi(text)
+			if err != nil {
+				return nil, fmt.Errorf("not a number or dice: %q", text)
+			}
+			if n > maxModifier {
+				return nil, fmt.Errorf("modifiers go up to %d: %q", maxModifier, text)
+			}
+			term.modifier = n
+		} else {
+			g, err := parseDiceGroup(text)
+			if err != nil {
+				return nil, err
+			}
+			dice += g.count
+			term.dice = g
+		}
+		terms = append(terms, term)
+		sign = 1
+	}
+	if dice > maxDice {
+		return nil, fmt.Errorf("more than %d dice", maxDice)
+	}
+	return terms, nil
+}
+
+// parseDiceGroup parses one NdS[!][kh|klK] term.
+func parseDiceGroup(text string) (*diceGroup, error) {
+	g := &diceGroup{count: 1}
+	countText, rest, _ := strings.Cut(text, "d")
+	if countText != "" {
+		n, err := strconv.Atoi(countText)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("bad dice count in %q", text)
+		}
+		g.count = n
+	}
+
+	sidesEnd := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsDigit(r) })
+	if sidesEnd < 0 {
+		sidesEnd = len(rest)
+	}
+	sides, err := strconv.Atoi(rest[:sidesEnd])
+	if err != nil || sides < 1 || sides > maxSides {
+		return nil, fmt.Errorf("dice in %q need 1 to %d sides", text, maxSides)
+	}
+	g.sides = sides
+	rest = rest[sidesEnd:]
+
+	if strings.HasPrefix(rest, "!") {
+		if sides < 2 {
+			return nil, fmt.Errorf("a one-sided die can't explode: %q", text)
+		}
+		g.explode, rest = true, rest[1:]
+	}
+	switch {
+	case rest == "":
+		return g, nil
+	case strings.HasPrefix(rest, "kh"):
+		rest = rest[2:]
+	case strings.HasPrefix(rest, "kl"):
+		g.lowest, rest = true, rest[2:]
+	default:
+		return nil, fmt.Errorf("unknown modifier %q in %q", rest, text)
+	}
+	keep, err := strconv.Atoi(rest)
+	if err != nil || keep < 1 || keep > g.count {
+		return nil, fmt.Errorf("can keep 1 to %d dice in %q", g.count, text)
+	}
+	g.keep = keep
+	return g, nil
+}
+
+// rollDice resolves parsed terms with roll, which returns a face from 1 to
+// sides.
+func rollDice(terms []parsedTerm, roll func(sides int) int) ([]DiceTerm, int) {
+	out := make([]DiceTerm, 0, len(terms))
+	total, thrown := 0, 0
+	for _, t := range terms {
+		dt := DiceTerm{Expr: t.expr, Sign: t.sign}
+		if t.dice == nil {
+			dt.Value = t.sign * t.modifier
+		} else {
+			g := t.dice
+			var kept []int
+			for range g.count {
+				face := roll(g.sides)
+				thrown++
+				dt.Rolls = append(dt.Rolls, face)
+				value := face
+				// an exploding die keeps rolling while it shows its highest
+				// face, all counted as one die; capped with the dice limit
+				for g.explode && face == g.sides && thrown < maxDice {
+					face = roll(g.sides)
+					thrown++
+					dt.Rolls = append(dt.Rolls, face)
+					value += face
+				}
+				kept = append(kept, value)
+			}
+			if g.keep > 0 {
+				slices.Sort(kept)
+				if g.lowest {
+					kept = kept[:g.keep]
+				} else {
+					kept = kept[len(kept)-g.keep:]
+				}
+			}
+			dt.Kept = kept
+			for _, v := range kept {
+				dt.Value += v
+			}
+			dt.Value *= t.sign
+		}
+		total += dt.Value
+		out = append(out, dt)
+	}
+	return out, total
+}
+
+// rollExprValue is the payload of a rollExpr message.
+type rollExprValue struct {
+	Expression string `json:"expression"`
+}
+
+// rollExpr resolves a dice expression with the server's randomness and
+// broadcasts the result to everyone, roller included, as a roll message, and
+// into the game log. Nothing about it touches g.Data.
+func (g *Game) rollExpr(from *Player, msg Message) {
+	var v rollExprValue
+	if msg.Value == nil || json.Unmarshal(msg.Value, &v) != nil {
+		g.sendError(from.ID, msg.Type, "invalid", "rollExpr needs an expression")
+		return
+	}
+	terms, err := parseDiceExpr(v.Expression)
+	if err != nil {
+		g.sendError(from.ID, msg.Type, "invalid", "bad dice expression: "+err.Error())
+		return
+	}
+
+	now := g.clock.Now()
+	result := RollResult{
+		Expression: strings.Join(strings.Fields(v.Expression), ""),
+		Roller:     from.ID,
+		Timestamp:  now.UnixMilli(),
+	}
+	result.Terms, result.Total = rollDice(terms, g.dice)
+
+	value, _ := json.Marshal(result)
+	payload, _ := json.Marshal(Message{
+		Type:      "roll",
+		PlayerID:  from.ID,
+		Timestamp: result.Timestamp,
+		Value:     value,
+	})
+	g.mu.Lock()
+	logged := g.recordLocked(from.ID, logLine{"roll", fmt.Sprintf("%s rolled %s → %d", from.ID, result.Expression, result.Total)})
+	g.LastActivity = now
+	g.mu.Unlock()
+
+	g.send(&PlayerMessage{To: []string{}, Content: payload, Type: "roll"})
+	g.sendLog(logged)
+}
+
+// rollFace is the server's die: a face from 1 to sides.
+func rollFace(sides int) int {
+	return rand.IntN(sides) + 1
+}
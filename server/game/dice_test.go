@@ -0,0 +1,94 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jollygrin/tts-server/clock"
+	"github.com/stretchr/testify/require"
+)
+
+// loaded returns dice that throw faces in order, then fail the test.
+func loaded(t *testing.T, faces ...int) func(int) int {
+	return func(sides int) int {
+		t.Helper()
+		require.NotEmpty(t, faces, "rolled more dice than expected")
+		face := faces[0]
+		faces = faces[1:]
+		require.LessOrEqual(t, face, sides)
+		return face
+	}
+}
+
+func TestParseDiceExpr(t *testing.T) {
+	for _, bad := range []string{"", "d", "4d", "0d6", "d0", "2d6kh3", "d6kx1", "1d1!", "+", "d6+", "101d6", "d1001", "d6+10001", "99999999999999999999", "abc"} {
+		_, err := parseDiceExpr(bad)
+		require.Error(t, err, bad)
+	}
+	terms, err := parseDiceExpr(" 4D6kh3 + 2 - d4 ")
+	require.NoError(t, err)
+	require.Len(t, terms, 3)
+	require.Equal(t, diceGroup{count: 4, sides: 6, keep: 3}, *terms[0].dice)
+	require.Equal(t, 2, terms[1].modifier)
+	require.Equal(t, -1, terms[2].sign)
+	require.Equal(t, diceGroup{count: 1, sides: 4}, *terms[2].dice)
+}
+
+func TestRollDiceKeepsAndExplodes(t *testing.T) {
+	terms, err := parseDiceExpr("4d6kh3+2")
+	require.NoError(t, err)
+	got, total := rollDice(terms, loaded(t, 3, 6, 1, 5))
+	require.Equal(t, []int{3, 6, 1, 5}, got[0].Rolls)
+	require.Equal(t, []int{3, 5, 6}, got[0].Kept)
+	require.Equal(t, 16, total)
+
+	terms, err = parseDiceExpr("2d6!kl1-1")
+	require.NoError(t, err)
+	got, total = rollDice(terms, loaded(t, 6, 6, 2, 4))
+	require.Equal(t, []int{6, 6, 2, 4}, got[0].Rolls)
+	require.Equal(t, []int{4}, got[0].Kept, "the exploded die counts as 14")
+	require.Equal(t, 3, total)
+}
+
+func TestRollExprIsBroadcastAndLogged(t *testing.T) {
+	g, out := NewGame(Config{Clock: clock.NewFake(time.Unix(1000, 0))})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	g.dice = loaded(t, 17)
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "rollExpr", Value: json.RawMessage(`{"expression":"d20 + 3"}`)})
+	pm, m := nextOfType(t, out, "roll")
+	require.Empty(t, pm.To, "everyone sees the roll")
+	var result RollResult
+	require.NoError(t, json.Unmarshal(m.Value, &result))
+	require.Equal(t, "d20+3", result.Expression)
+	require.Equal(t, "alice", result.Roller)
+	require.Equal(t, 20, result.Total)
+	require.Equal(t, []int{17}, result.Terms[0].Kept)
+	require.Equal(t, int64(1_000_000), result.Timestamp, "stamped by the game's clock")
+	require.Contains(t, logTexts(g), "alice rolled d20+3 → 20")
+
+	g.HandleMessage(alice, Message{Type: "rollExpr", Value: json.RawMessage(`{"expression":"4d"}`)})
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "invalid", errorCode(t, m))
+}
+
+func TestClientCannotForgeARoll(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "roll", PlayerID: "bob", Value: json.RawMessage(`{"roller":"bob","total":20}`)})
+	pm, m := nextOfType(t, out, "error")
+	require.Equal(t, []string{"alice"}, pm.To)
+	require.Equal(t, "unknown_type", errorCode(t, m))
+	require.Empty(t, out, "a forged roll must not be relayed")
+
+	// what is relayed carries the sender's id, whatever it claimed
+	g.HandleMessage(alice, Message{Type: "camera", PlayerID: "bob", Value: json.RawMessage(`{}`)})
+	pm, m = nextOfType(t, out, "camera")
+	require.Equal(t, "alice", pm.Exclude)
+	require.Equal(t, "alice", m.PlayerID)
+}
@@ -0,0 +1,135 @@
+package game
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event kinds published on a game's Events hub.
+const (
+	EventInbound   = "inbound"   // a message read from a client socket
+	EventPatch     = "patch"     // a client or admin patch merged into state
+	EventPresence  = "presence"  // a server-owned player row changed
+	EventRateLimit = "rateLimit" // a client disconnected for its message rate
+	EventDropped   = "dropped"   // a message dropped instead of blocking
+	EventResync    = "resync"    // a fresh sync for a client that missed messages
+	EventStalled   = "stalled"   // a client disconnected for staying behind
+	EventHeartbeat = "heartbeat" // a client disconnected for missing a pong
+	EventClock     = "clock"     // a game clock ran out
+)
+
+// Event is one traced happening in a lobby, for the admin event stream.
+type Event struct {
+	Kind   string          `json:"kind"`
+	Type   string          `json:"type,omitempty"`
+	Player string          `json:"player,omitempty"`
+	Time   time.Time       `json:"time"`
+	Value  json.RawMessage `json:"value,omitempty"`
+}
+
+// EventFilter narrows a subscription; empty fields match everything.
+type EventFilter struct {
+	Kinds   []string
+	Types   []string
+	Players []string
+}
+
+func (f EventFilter) match(e Event) bool {
+	return matchAny(f.Kinds, e.Kind) && matchAny(f.Types, e.Type) && matchAny(f.Players, e.Player)
+}
+
+func matchAny(set []string, v string) bool {
+	if len(set) == 0 {
+		return true
+	}
+	for _, s := range set {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Events fans a lobby's events out to admin subscribers. Publishing never
+// blocks: a subscriber that can't keep up misses events rather than stalling
+// the lobby. With nobody subscribed, Active is false and publishers skip
+// building events at all.
+type Events struct {
+	mu     sync.Mutex
+	subs   map[chan Event]EventFilter
+	active atomic.Int32
+	closed bool
+}
+
+func newEvents() *Events {
+	return &Events{subs: make(map[chan Event]EventFilter)}
+}
+
+// Active reports whether anyone is subscribed.
+func (h *Events) Active() bool {
+	return h.active.Load() > 0
+}
+
+// Publish stamps e and delivers it to every matching subscriber.
+func (h *Events) Publish(e Event) {
+	if !h.Active() {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch, f := range h.subs {
+		if !f.match(e) {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of matching events and a func ending the
+// subscription. The channel is closed by that func, or when the hub closes
+// with its lobby.
+func (h *Events) Subscribe(f EventFilter) (<-chan Event, func()) {
+	ch := make(chan Event, 256)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	h.subs[ch] = f
+	h.active.Add(1)
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[ch]; ok {
+			delete(h.subs, ch)
+			h.active.Add(-1)
+			close(ch)
+		}
+	}
+}
+
+// Close ends every subscription.
+func (h *Events) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		h.active.Add(-1)
+		close(ch)
+	}
+}
+
+// Events is the game's admin event hub.
+func (g *Game) Events() *Events {
+	return g.events
+}
@@ -2,19 +2,32 @@ package game
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
 	"time"
 
 	"github.com/jollygrin/tts-server/jsonmerge"
+	"github.com/jollygrin/tts-server/metrics"
 	"github.com/rs/zerolog/log"
 )
 
+// relayed are the client message types broadcast as they came, with nothing
+// for the server to do but pass them on.
+var relayed = map[string]bool{
+	"camera": true,
+}
+
 // HandleMessage handles incoming messages from players
 // If a message is returned, send it back to the caller.
 // TODO: Make this a channel and async go routine
 func (g *Game) HandleMessage(from *Player, msg Message) {
-	if msg.PlayerID == "" {
-		// This feels like a bug futher up and should not be fixed here.
-		msg.PlayerID = from.ID
+	// whatever the client claims, a message is from the socket that sent it
+	msg.PlayerID = from.ID
+
+	if reason := g.forbidden(from, msg.Type); reason != "" {
+		g.sendError(from.ID, msg.Type, "forbidden", reason)
+		return
 	}
 
 	switch msg.Type {
@@ -26,30 +39,85 @@ func (g *Game) HandleMessage(from *Player, msg Message) {
 		// is nothing to relay and no client handles this type anymore
 		return
 	case "update":
-		g.update(msg)
+		value, ok := g.update(from, msg)
+		if !ok {
+			return
+		}
+		// relay what was merged, not what was sent — stripped server-owned
+		// fields must not reach the other clients either, nor the cards in
+		// someone else's tray
+		msg.Value = value
+		g.relayUpdate(msg, from.ID)
+		return
 	case "camera":
 		// Ephemeral tier (SPEC.md §4c). Presence-only traffic — remote camera
 		// poses today. Deliberately does NOT touch g.Data: it must never be
 		// persisted, never appear in a `sync` snapshot and never replay to a
 		// joiner. Falling straight through to the broadcast below *is* the
 		// contract; this case exists so nobody "fixes" it into an update.
+	case "reset":
+		g.reset(from)
+		return
+	case "kick", "ban":
+		g.kick(from, msg)
+		return
+	case "setRole":
+		g.setRole(from, msg)
+		return
+	case "resetSecret":
+		g.resetSecret(from, msg)
+		return
+	case "chat":
+		g.chat(from, msg)
+		return
+	case "setTurnOrder", "endTurn", "passTurn", "setRound":
+		g.turn(from, msg)
+		return
+	case "setClocks", "startClock", "stopClock", "pauseClock", "resumeClock":
+		g.clocks(from, msg)
+		return
+	case "claimSeat", "releaseSeat":
+		g.seats(from, msg)
+		return
+	case "setCapacity", "admit":
+		g.waitingRoom(from, msg)
+		return
+	case "rollExpr":
+		g.rollExpr(from, msg)
+		return
+	case "increment", "decrement":
+		g.counter(from, msg)
+		return
+	case "peek", "reveal":
+		g.private(from, msg)
+		return
+	case "bagDraw", "bagInsert":
+		g.bags(from, msg)
+		return
+	default:
+		// only the types in relayed may pass through verbatim; anything else
+		// — roll, log, peek and the rest the server sends — would let a
+		// client speak for the server
+		if !relayed[msg.Type] {
+			g.sendError(from.ID, msg.Type, "unknown_type", "cannot send "+msg.Type)
+			return
+		}
 	}
 
-	// For whatever reason, we broadcast every message.
-	// This feels.... wrong
 	data, _ := json.Marshal(msg)
-	g.out <- &PlayerMessage{ // TODO: Full channel problems
+	g.send(&PlayerMessage{
 		To:      []string{},
 		Exclude: from.ID,
 		Content: data,
-	}
+		Type:    msg.Type,
+	})
 }
 
 func (g *Game) SyncPlayerState(id string) {
 	// marshal under the lock, send after releasing it — sending to a possibly
 	// full channel while holding the state mutex can deadlock the lobby
 	g.mu.Lock()
-	data, err := json.Marshal(g.Data)
+	data, err := json.Marshal(hideTrays(g.Data, id, g.Players))
 	g.mu.Unlock()
 	if err != nil {
 		log.Err(err).Msg("Failed to marshal state for sync")
@@ -64,10 +132,11 @@ func (g *Game) SyncPlayerState(id string) {
 	}
 	payload, _ := json.Marshal(returnMsg)
 
-	g.out <- &PlayerMessage{
+	g.send(&PlayerMessage{
 		To:      []string{id},
 		Content: payload,
-	}
+		Type:    "sync",
+	})
 }
 
 // DisconnectPlayer marks the player's socket as gone. The offline broadcast is
@@ -82,6 +151,11 @@ func (g *Game) DisconnectPlayer(p *Player) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	if g.Players[p.ID] != p {
+		// kicked: the player was already removed, and a returning id is a
+		// new *Player whose presence this socket has no say in
+		return
+	}
 	p.conns--
 	if p.conns > 0 {
 		// another live socket for the same player id (overlapping reconnect) —
@@ -95,6 +169,9 @@ func (g *Game) DisconnectPlayer(p *Player) {
 	if t, ok := g.offlineTimers[id]; ok {
 		t.Stop()
 	}
+	if g.closed() {
+		return // nobody left to tell
+	}
 	g.offlineTimers[id] = time.AfterFunc(g.offlineGrace, func() {
 		g.broadcastOffline(id)
 	})
@@ -111,12 +188,54 @@ func (g *Game) broadcastOffline(id string) {
 		return
 	}
 	payload := g.mergePresenceLocked(id, false)
+	lines := []logLine{{"leave", id + " left"}}
+	// a host who is really gone hands the lobby to the longest-seated player,
+	// so host-only actions never become unreachable
+	var handoff []byte
+	if p.Role == RoleHost {
+		if next := g.nextHostLocked(); next != nil {
+			p.Role = RolePlayer
+			next.Role = RoleHost
+			handoff = g.mergeRolesLocked(p, next)
+			lines = append(lines, logLine{"role", next.ID + " is now the host"})
+		}
+	}
+	logged := g.recordLocked(id, lines...)
+	// a player gone for good makes room for whoever is waiting
+	var waiting waitingChange
+	if len(g.waiting) > 0 {
+		waiting = g.fillLocked(id)
+	}
 	g.mu.Unlock()
 	g.sendPresence(payload)
+	g.sendPresence(handoff)
+	g.sendLog(logged)
+	waiting.send(g)
 }
 
-func (g *Game) ConnectPlayer(playerID string) *Player {
+// ConnectPlayer attaches a socket for playerID. role is the role asked for on
+// join — RolePlayer or RoleSpectator. A returning player keeps the role they
+// already hold; the first player into a lobby without a host becomes host.
+//
+// A new id that would exceed Limits.MaxPlayers is refused with ErrLobbyFull,
+// a banned id with ErrBanned, and a known id without the secret it was issued
+// on its first join (see Welcome) with ErrWrongSecret, unless the host reset
+// it.
+func (g *Game) ConnectPlayer(playerID, secret string, role Role) (*Player, error) {
 	g.mu.Lock()
+	if _, banned := g.banned[playerID]; banned {
+		g.mu.Unlock()
+		return nil, ErrBanned
+	}
+	if p, known := g.Players[playerID]; known && p.secret != "" && !secretMatches(p, secret) {
+		g.mu.Unlock()
+		return nil, ErrWrongSecret
+	}
+	if _, known := g.Players[playerID]; !known && g.limits.MaxPlayers > 0 && len(g.Players) >= g.limits.MaxPlayers {
+		g.rejectedPlayers++
+		g.mu.Unlock()
+		return nil, ErrLobbyFull
+	}
 	g.LastActivity = time.Now()
 
 	// reconnect inside the grace period: the offline patch was never sent, so
@@ -127,43 +246,99 @@ func (g *Game) ConnectPlayer(playerID string) *Player {
 	}
 
 	player, ok := g.Players[playerID]
+	var logged []byte
+	if !ok && role == RolePlayer && g.fullLocked() {
+		// the table is full: watch from the stands until a place opens up
+		role = RoleSpectator
+		g.waitLocked(playerID)
+	}
 	if !ok {
 		player = &Player{
 			ID:            playerID,
-			JoinTimestamp: time.Now().UnixMilli(),
-			Seat:          0,
+			JoinTimestamp: g.storedJoinTimestampLocked(playerID),
+			Role:          role,
+			Seat:          NoSeat,
+			secret:        newSecret(),
 		}
 		g.Players[playerID] = player
+		joined := logLine{"join", playerID + " joined"}
+		if slices.Contains(g.waiting, playerID) {
+			joined.text += " and is waiting for a place"
+		} else if role == RoleSpectator {
+			joined.text += " as a spectator"
+		}
+		logged = g.recordLocked(playerID, joined)
+	}
+	if player.secret == "" {
+		// the host reset it (see resetSecret)
+		player.secret = newSecret()
+	}
+	if player.Role == RolePlayer && g.hostLocked() == nil {
+		player.Role = RoleHost
 	}
 	player.conns++
 	player.Connected = true
 
-	payload := g.mergePresenceLocked(playerID, true)
+	payload := g.mergePlayerLocked(playerID, serverRowLocked(player))
+	// a waiter gets their place in line, a returning one included
+	var waiting waitingChange
+	if len(g.waiting) > 0 {
+		waiting = g.fillLocked(playerID)
+	}
 	g.mu.Unlock()
 
 	// send outside the lock — a full channel while holding g.mu can deadlock
 	g.sendPresence(payload)
-	return player
+	g.sendLog(logged)
+	waiting.send(g)
+	return player, nil
+}
+
+// storedJoinTimestampLocked returns the joinTimestamp already recorded for id
+// in g.Data — a player returning to a lobby keeps their place in join order —
+// or now for a first-time joiner. Caller must hold g.mu.
+func (g *Game) storedJoinTimestampLocked(id string) int64 {
+	players, _ := g.Data["players"].(map[string]any)
+	row, _ := players[id].(map[string]any)
+	if ts, ok := row["joinTimestamp"].(float64); ok && ts > 0 {
+		return int64(ts)
+	}
+	return time.Now().UnixMilli()
 }
 
 // mergePresenceLocked merges {"players": {id: {"connected": v}}} into g.Data
 // and returns the marshaled update message to broadcast. Caller must hold g.mu.
 //
-// The patch may create a partial row for an id not yet in g.Data.players (the
-// socket attaches before the client sends any player data); the HUD skips rows
-// without a joinTimestamp, so such rows are never rendered.
+// A spectator's row carries presence and role but never a joinTimestamp (see
+// serverRowLocked); the HUD skips rows without one, so spectators are never
+// rendered as seated players.
 func (g *Game) mergePresenceLocked(playerID string, connected bool) []byte {
-	patch := map[string]any{
-		"players": map[string]any{playerID: map[string]any{"connected": connected}},
-	}
+	return g.mergePlayerLocked(playerID, map[string]any{"connected": connected})
+}
+
+// mergePlayerLocked merges server-owned fields into g.Data.players[playerID]
+// and returns the marshaled update message to broadcast. Caller must hold g.mu.
+func (g *Game) mergePlayerLocked(playerID string, fields map[string]any) []byte {
+	return g.mergeServerPatchLocked(playerID, map[string]any{
+		"players": map[string]any{playerID: fields},
+	})
+}
+
+// mergeServerPatchLocked merges a server-authored patch into g.Data and
+// returns it as a marshaled update message attributed to playerID. Caller
+// must hold g.mu.
+func (g *Game) mergeServerPatchLocked(playerID string, patch map[string]any) []byte {
 	g.Data = jsonmerge.MergeMaps(g.Data, patch)
 	g.Updates++
 
 	value, err := json.Marshal(patch)
 	if err != nil {
-		log.Err(err).Msg("Failed to marshal presence patch")
+		log.Err(err).Msg("Failed to marshal server patch")
 		return nil
 	}
+	// keep stateBytes an upper bound (see stateFitsLocked)
+	g.stateBytes += len(value)
+	g.events.Publish(Event{Kind: EventPresence, Type: "update", Player: playerID, Value: value})
 	msg := Message{
 		Type:      "update",
 		PlayerID:  playerID,
@@ -172,7 +347,7 @@ func (g *Game) mergePresenceLocked(playerID string, connected bool) []byte {
 	}
 	payload, err := json.Marshal(msg)
 	if err != nil {
-		log.Err(err).Msg("Failed to marshal presence message")
+		log.Err(err).Msg("Failed to marshal server patch message")
 		return nil
 	}
 	return payload
@@ -180,35 +355,207 @@ func (g *Game) mergePresenceLocked(playerID string, connected bool) []byte {
 
 // sendPresence broadcasts a presence update to the whole lobby without ever
 // blocking: DisconnectPlayer's timer can fire after the lobby stopped draining
-// g.out, and a stuck send there would leak the goroutine. Dropping a presence
-// patch on a full channel is harmless — the next sync carries the same state.
+// g.out, and a stuck send there would leak the goroutine. A dropped patch is
+// flagged for TakeDropped, so the lobby re-syncs everyone.
 func (g *Game) sendPresence(payload []byte) {
 	if payload == nil {
 		return
 	}
 	select {
-	case g.out <- &PlayerMessage{To: []string{}, Content: payload}:
+	case g.out <- &PlayerMessage{To: []string{}, Content: payload, Type: "update"}:
 	default:
+		metrics.Dropped.WithLabelValues(metrics.DropGameOutFull).Inc()
+		g.events.Publish(Event{Kind: EventDropped, Type: "update", Value: payload})
+		g.dropped.Store(true)
 		log.Warn().Msg("game out channel full, dropping presence update")
 	}
 }
 
-func (g *Game) update(msg Message) {
-	if msg.Value == nil {
-		log.Error().Msgf("Invalid update message: missing path or value")
-		return
+// send queues pm for the lobby. It blocks while g.out is full, but gives up
+// once the game is closed: the lobby no longer drains it, and a sender stuck
+// there would never return.
+func (g *Game) send(pm *PlayerMessage) {
+	select {
+	case g.out <- pm:
+	case <-g.done:
+	}
+}
+
+func (g *Game) closed() bool {
+	select {
+	case <-g.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close ends the game when its lobby goes away: pending sends give up, offline
+// timers are stopped and no new ones are armed. Safe to call more than once.
+func (g *Game) Close() {
+	g.closeOnce.Do(func() {
+		close(g.done)
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		for id, t := range g.offlineTimers {
+			t.Stop()
+			delete(g.offlineTimers, id)
+		}
+		g.stopClocksLocked()
+	})
+}
+
+// TakeDropped reports whether a broadcast was dropped since the last call,
+// clearing the flag. Every client missed it.
+func (g *Game) TakeDropped() bool {
+	return g.dropped.Swap(false)
+}
+
+// offer sends pm unless g.out is full, and reports whether it was sent. For
+// messages sent from places that must never block. A dropped message is
+// flagged for TakeDropped like a dropped presence patch, so whoever missed
+// it is re-synced.
+func (g *Game) offer(pm *PlayerMessage) bool {
+	select {
+	case g.out <- pm:
+		return true
+	default:
+		metrics.Dropped.WithLabelValues(metrics.DropGameOutFull).Inc()
+		g.events.Publish(Event{Kind: EventDropped, Type: pm.Type, Value: pm.Content})
+		g.dropped.Store(true)
+		return false
+	}
+}
+
+// update merges a client patch into g.Data and returns the value to relay.
+// ok is false when nothing was merged; the sender has already been told why
+// if it was rejected.
+func (g *Game) update(from *Player, msg Message) (value json.RawMessage, ok bool) {
+	value, err := g.applyPatch(from, msg.Value)
+	if err == nil {
+		return value, true
+	}
+	var rej *rejection
+	if errors.As(err, &rej) {
+		log.Warn().Str("player", from.ID).Msg("Rejected update: " + err.Error())
+		g.sendError(from.ID, msg.Type, rej.code, err.Error())
+	} else if !errors.Is(err, errNothingToMerge) {
+		log.Err(err).Str("player", from.ID).Msg("Invalid update message")
+	}
+	return nil, false
+}
+
+// rejection is a patch refused for a reason its sender should hear about;
+// code becomes the error message's code.
+type rejection struct {
+	code string
+	err  error
+}
+
+func (r *rejection) Error() string { return r.err.Error() }
+func (r *rejection) Unwrap() error { return r.err }
+
+// IsRejection reports whether err is a patch refused by the game's rules
+// (ownership, state size) rather than a malformed one.
+func IsRejection(err error) bool {
+	var rej *rejection
+	return errors.As(err, &rej)
+}
+
+// errNothingToMerge: every field of the patch was server-owned and dropped.
+var errNothingToMerge = errors.New("nothing to merge")
+
+// applyPatch authorizes a patch (see authorizePatch) on behalf of from — nil
+// for an admin, who may write anything a host may — merges it under the state
+// size limit and returns the value to relay.
+func (g *Game) applyPatch(from *Player, raw json.RawMessage) (json.RawMessage, error) {
+	if raw == nil {
+		return nil, errors.New("missing value")
 	}
 
 	// decode outside the lock; only the merge itself needs exclusivity
 	var patch map[string]any
-	if err := json.Unmarshal(msg.Value, &patch); err != nil {
-		log.Err(err).Msg("Failed to decode update value")
-		return
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return nil, fmt.Errorf("decode update value: %w", err)
 	}
 
+	var (
+		logged     []byte
+		refused    *rejection
+		correction *PlayerMessage
+	)
 	g.mu.Lock()
-	defer g.mu.Unlock()
+	defer func() {
+		g.mu.Unlock()
+		g.sendLog(logged)
+		// the rest of the patch went through; the refused claim is told apart
+		if correction != nil {
+			g.send(correction)
+			g.sendError(from.ID, "update", refused.code, refused.Error())
+		}
+	}()
+	fromID, role := "", RoleHost
+	if from != nil {
+		fromID, role = from.ID, from.Role
+	}
+	stripped, reason := authorizePatch(fromID, role, g.rowOwnerLocked, patch)
+	if reason != "" {
+		return nil, &rejection{"forbidden", errors.New(reason)}
+	}
+	// seat writes on a player's row are claims the server arbitrates
+	claims, rej := g.seatClaimsLocked(patch)
+	if rej != nil {
+		return nil, rej
+	}
+	commitSeats := func() {}
+	if len(claims) > 0 {
+		seats, commit, seatRefused, rej := g.seatPatchLocked(claims, role == RoleHost)
+		if rej != nil {
+			return nil, rej
+		}
+		mergeSeatPatch(patch, seats)
+		commitSeats, stripped, refused = commit, true, seatRefused
+	}
+	// bag contents stay on the server; the patch keeps their counts
+	commitBags, pooled, bagsStripped, rej := g.bagPatchLocked(patch)
+	if rej != nil {
+		return nil, rej
+	}
+	stripped = stripped || bagsStripped
+	if len(patch) == 0 {
+		return nil, errNothingToMerge
+	}
+	value := raw
+	if stripped {
+		// marshal before merging — MergeMaps adopts the patch's subtrees
+		value, _ = json.Marshal(patch)
+	}
+	// phrase the patch against the state it lands on, before merging adopts it
+	lines := describePatch(fromID, g.Data, patch)
+	var undo map[string]any
+	if g.limits.MaxStateBytes > 0 {
+		undo = jsonmerge.Inverse(g.Data, patch)
+	}
+	start := time.Now()
 	g.Data = jsonmerge.MergeMaps(g.Data, patch)
+	metrics.MergeSeconds.Observe(time.Since(start).Seconds())
+	if !g.stateFitsLocked(len(value), pooled, undo) {
+		g.Data = jsonmerge.MergeMaps(g.Data, undo)
+		g.rejectedUpdates++
+		return nil, &rejection{"state_too_large", ErrStateTooLarge}
+	}
+	commitSeats()
+	commitBags()
+	if refused != nil && from != nil {
+		correction = g.seatCorrectionLocked(from)
+	}
 	g.Updates++
 	g.LastActivity = time.Now()
+	player := AdminID
+	if from != nil {
+		player = from.ID
+	}
+	g.events.Publish(Event{Kind: EventPatch, Type: "update", Player: player, Value: value})
+	logged = g.recordLocked(player, lines...)
+	return value, nil
 }
@@ -28,6 +28,22 @@ func nextOfType(t *testing.T, out <-chan *PlayerMessage, want string) (*PlayerMe
 	}
 }
 
+// mustConnect joins id, or reconnects it with its secret.
+func mustConnect(t *testing.T, g *Game, id string, role Role) *Player {
+	t.Helper()
+	g.mu.Lock()
+	var secret string
+	if p, ok := g.Players[id]; ok {
+		secret = p.secret
+	}
+	g.mu.Unlock()
+	p, err := g.ConnectPlayer(id, secret, role)
+	if err != nil {
+		t.Fatalf("connect %s: %v", id, err)
+	}
+	return p
+}
+
 func drain(out <-chan *PlayerMessage) {
 	for {
 		select {
@@ -46,8 +62,8 @@ func drain(out <-chan *PlayerMessage) {
 // legitimately writes players[id].connected on attach, so the test pins the
 // state *before* the camera traffic and requires it to be byte-identical after.
 func TestCameraMessageIsRelayedButNeverMerged(t *testing.T) {
-	g, out := NewGame()
-	alice := g.ConnectPlayer("alice")
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
 	drain(out) // alice's presence patch
 
 	g.mu.Lock()
@@ -93,8 +109,8 @@ func TestCameraMessageIsRelayedButNeverMerged(t *testing.T) {
 // A joiner's sync snapshot is g.Data — so if camera never merges, it can never
 // appear there. Presence *is* expected in the snapshot; camera poses are not.
 func TestSyncSnapshotContainsNoCameraData(t *testing.T) {
-	g, out := NewGame()
-	alice := g.ConnectPlayer("alice")
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
 
 	g.HandleMessage(alice, Message{
 		Type:     "update",
@@ -152,3 +168,31 @@ func containsSub(s, sub string) bool {
 	}
 	return false
 }
+
+func TestClosedGameNeverBlocksSenders(t *testing.T) {
+	g, out := NewGame(Config{OutBuffer: 1, OfflineGrace: time.Millisecond})
+	alice := mustConnect(t, g, "alice", RolePlayer) // fills the channel
+	if len(out) != 1 {
+		t.Fatalf("expected a full channel, got %d messages", len(out))
+	}
+
+	g.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.SyncPlayerState("alice")
+		g.HandleMessage(alice, Message{Type: "camera", Value: json.RawMessage(`{}`)})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("a send on a closed game blocked")
+	}
+
+	g.DisconnectPlayer(alice)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.offlineTimers) != 0 {
+		t.Fatal("an offline timer outlived the game")
+	}
+}
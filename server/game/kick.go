@@ -0,0 +1,132 @@
+package game
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrBanned is returned by ConnectPlayer for a player banned from the game.
+	ErrBanned = errors.New("banned from this lobby")
+	// ErrUnknownPlayer is returned when a kick or ban names nobody in the game.
+	ErrUnknownPlayer = errors.New("no such player")
+)
+
+// KickOptions tunes Kick.
+type KickOptions struct {
+	// Reason is shown to the kicked player as the socket close reason.
+	Reason string
+	// Ban refuses the player id on every later connect.
+	Ban bool
+	// BanIP, with Ban, also refuses the player's source address, or the last
+	// one they connected from when they're offline.
+	BanIP bool
+}
+
+// Kick closes every socket of the player and removes them from the game —
+// their Players entry and their players row, so the table forgets the seat.
+// Used by the host's kick/ban messages and the admin pages.
+func (g *Game) Kick(id string, opts KickOptions) error {
+	g.mu.Lock()
+	p, ok := g.Players[id]
+	if !ok && !opts.Ban {
+		g.mu.Unlock()
+		return ErrUnknownPlayer
+	}
+	var (
+		payloads [][]byte
+		waiting  waitingChange
+	)
+	if ok {
+		payloads = g.removePlayerLocked(p)
+		if wasWaiting := g.unwaitLocked(id); wasWaiting || len(g.waiting) > 0 {
+			waiting = g.fillLocked(id)
+		}
+	}
+	if opts.Reason == "" {
+		opts.Reason = "kicked from the lobby"
+		if opts.Ban {
+			opts.Reason = ErrBanned.Error()
+		}
+	}
+	removed := logLine{"kick", id + " was kicked"}
+	if opts.Ban {
+		g.banned[id] = opts.Reason
+		removed.text = id + " was banned"
+	}
+	g.LastActivity = time.Now()
+	logged := g.recordLocked(id, removed)
+	g.mu.Unlock()
+
+	log.Info().Str("player", id).Bool("ban", opts.Ban).Bool("banIP", opts.BanIP).Msg("Kicking player")
+	g.send(&PlayerMessage{
+		To:    []string{id},
+		Close: opts.Reason,
+		BanIP: opts.Ban && opts.BanIP,
+	})
+	for _, payload := range payloads {
+		g.sendPresence(payload)
+	}
+	g.sendLog(logged)
+	waiting.send(g)
+	return nil
+}
+
+// removePlayerLocked forgets p entirely and returns the patches to broadcast:
+// the null players row, and the host handoff if p was host. The sockets still
+// attached to p are closed by the caller; their late DisconnectPlayer calls
+// land on the detached *Player and change nothing, and whatever they send
+// before they close is refused. Caller must hold g.mu.
+func (g *Game) removePlayerLocked(p *Player) [][]byte {
+	if t, ok := g.offlineTimers[p.ID]; ok {
+		t.Stop()
+		delete(g.offlineTimers, p.ID)
+	}
+	delete(g.Players, p.ID)
+	p.removed = true
+	removal := map[string]any{"players": map[string]any{p.ID: nil}}
+	if vacated := g.vacateSeatLocked(p); vacated != nil {
+		removal["seats"] = vacated
+	}
+	payloads := [][]byte{g.mergeServerPatchLocked(p.ID, removal)}
+	if p.Role == RoleHost {
+		if next := g.nextHostLocked(); next != nil {
+			next.Role = RoleHost
+			payloads = append(payloads, g.mergeRolesLocked(next))
+		}
+	}
+	return payloads
+}
+
+// kick handles the host's kick and ban messages. The host cannot remove
+// themselves.
+func (g *Game) kick(from *Player, msg Message) {
+	target, ok := decodeTarget(msg)
+	if !ok {
+		g.sendError(from.ID, msg.Type, "invalid", msg.Type+" needs a player")
+		return
+	}
+	if target.Player == from.ID {
+		g.sendError(from.ID, msg.Type, "invalid", "the host cannot "+msg.Type+" themselves")
+		return
+	}
+
+	opts := KickOptions{Reason: target.Reason}
+	if opts.Reason == "" {
+		opts.Reason = "kicked by host"
+	}
+	if msg.Type == "ban" {
+		opts.Ban = true
+		opts.BanIP = target.IP
+		if target.Reason == "" {
+			opts.Reason = "banned by host"
+		}
+	}
+	if err := g.Kick(target.Player, opts); err != nil {
+		g.sendError(from.ID, msg.Type, "unknown_player", err.Error()+": "+target.Player)
+		return
+	}
+	log.Info().Str("player", target.Player).Str("by", from.ID).Msg("Host removed player")
+}
@@ -0,0 +1,101 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKickRemovesPlayerAndRow(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	g.HandleMessage(bob, Message{Type: "update", Value: json.RawMessage(`{"players":{"bob":{"tray":{"c1":{}}}}}`)})
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "kick", Value: json.RawMessage(`{"player":"bob","reason":"wrong table"}`)})
+	pm := <-out
+	require.Equal(t, []string{"bob"}, pm.To)
+	require.Equal(t, "wrong table", pm.Close)
+	require.False(t, pm.BanIP)
+
+	_, m := nextOfType(t, out, "update")
+	require.JSONEq(t, `{"players":{"bob":null}}`, string(m.Value))
+	require.NotContains(t, g.Players, "bob")
+	require.Nil(t, playerRow(t, g, "bob"))
+
+	// the socket's close lands afterwards and must not resurrect anything
+	g.DisconnectPlayer(bob)
+	require.NotContains(t, g.Players, "bob")
+
+	// a plain kick does not stop bob coming back
+	_, err := g.ConnectPlayer("bob", "", RolePlayer)
+	require.NoError(t, err)
+}
+
+func TestBanRefusesReconnect(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "ban", Value: json.RawMessage(`{"player":"bob","ip":true}`)})
+	pm := <-out
+	require.Equal(t, "banned by host", pm.Close)
+	require.True(t, pm.BanIP)
+	drain(out)
+
+	_, err := g.ConnectPlayer("bob", "", RolePlayer)
+	require.ErrorIs(t, err, ErrBanned)
+	_, err = g.ConnectPlayer("bob", "", RoleSpectator)
+	require.ErrorIs(t, err, ErrBanned)
+	require.Equal(t, []string{"bob"}, g.Stats().Banned)
+}
+
+func TestHostCannotKickThemselves(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "ban", Value: json.RawMessage(`{"player":"alice"}`)})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "invalid", errorCode(t, m))
+	require.Contains(t, g.Players, "alice")
+}
+
+func TestAdminKickOfHostHandsOverHost(t *testing.T) {
+	g, out := NewGame(Config{})
+	mustConnect(t, g, "alice", RolePlayer)
+	time.Sleep(2 * time.Millisecond) // distinct join timestamps
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	require.NoError(t, g.Kick("alice", KickOptions{}))
+	require.Equal(t, RoleHost, bob.Role)
+	require.ErrorIs(t, g.Kick("nobody", KickOptions{}), ErrUnknownPlayer)
+	// banning an id that never joined pre-empts it
+	require.NoError(t, g.Kick("nobody", KickOptions{Ban: true}))
+	_, err := g.ConnectPlayer("nobody", "", RolePlayer)
+	require.ErrorIs(t, err, ErrBanned)
+}
+
+func TestKickedHostCannotActOnTheWayOut(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer) // host
+	mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	require.NoError(t, g.Kick("alice", KickOptions{}))
+	drain(out)
+	// alice's socket is still closing; what it sends now is not the host's
+	g.HandleMessage(alice, Message{Type: "reset"})
+	pm, m := nextOfType(t, out, "error")
+	require.Equal(t, []string{"alice"}, pm.To)
+	require.Equal(t, "forbidden", errorCode(t, m))
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(`{"decks":{}}`)})
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "forbidden", errorCode(t, m))
+	require.Equal(t, RoleHost, roleOf(g, "bob"))
+}
@@ -0,0 +1,76 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Limits caps what a single game may hold, so one lobby can't exhaust the
+// server. Zero means unlimited.
+type Limits struct {
+	// MaxPlayers caps distinct player ids, spectators included. Players
+	// already in the game can always reconnect.
+	MaxPlayers int
+	// MaxStateBytes caps the encoded size of g.Data, with what the bags
+	// hold, after a client merge, a bag draw or a bag insert.
+	MaxStateBytes int
+}
+
+var (
+	// ErrLobbyFull is returned by ConnectPlayer when a new id would exceed
+	// Limits.MaxPlayers.
+	ErrLobbyFull = errors.New("lobby is full: too many players")
+	// ErrStateTooLarge rejects an update that would grow g.Data past
+	// Limits.MaxStateBytes.
+	ErrStateTooLarge = errors.New("table state is too large")
+)
+
+// stateFitsLocked reports whether g.Data may stay as it is after merging a
+// patch that encoded to grow bytes and filled new bags with pooled bytes;
+// undo is that patch's inverse. g.stateBytes is a running upper bound — every
+// merge, the server's own included, adds its patch — so the full state is only
+// encoded once that bound, with the pools, crosses the cap. Caller must hold
+// g.mu.
+func (g *Game) stateFitsLocked(grow, pooled int, undo map[string]any) bool {
+	max := g.limits.MaxStateBytes
+	if max <= 0 {
+		return true
+	}
+	g.stateBytes += grow
+	if g.stateBytes+g.poolBytesLocked()+pooled <= max {
+		return true
+	}
+
+	data, err := json.Marshal(g.Data)
+	if err != nil {
+		return false
+	}
+	g.stateBytes = len(data)
+	if g.stateBytes+g.poolBytesLocked()+pooled <= max {
+		return true
+	}
+	// over the cap — but a patch no bigger than what it replaced (a move, a
+	// delete) must still go through, or a full table could never be cleared
+	replaced, err := json.Marshal(undo)
+	return err == nil && grow+pooled <= len(replaced)
+}
+
+// growthFitsLocked reports whether the state may grow by grow bytes while
+// freed bytes leave it — a bag draw spawning an entity out of a pool, or an
+// insert moving one into it — and stay under Limits.MaxStateBytes. A move
+// that grows nothing always fits. Caller must hold g.mu.
+func (g *Game) growthFitsLocked(grow, freed int) bool {
+	max := g.limits.MaxStateBytes
+	if max <= 0 || grow <= freed {
+		return true
+	}
+	if g.stateBytes+g.poolBytesLocked()+grow-freed <= max {
+		return true
+	}
+	data, err := json.Marshal(g.Data)
+	if err != nil {
+		return false
+	}
+	g.stateBytes = len(data)
+	return g.stateBytes+g.poolBytesLocked()+grow-freed <= max
+}
@@ -0,0 +1,82 @@
+package game
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxPlayersRefusesNewIDsButNotReturningOnes(t *testing.T) {
+	g, out := NewGame(Config{Limits: Limits{MaxPlayers: 2}})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RolePlayer)
+
+	_, err := g.ConnectPlayer("carol", "", RolePlayer)
+	require.ErrorIs(t, err, ErrLobbyFull)
+	require.NotContains(t, g.Players, "carol")
+
+	// a refresh from alice is not a new player
+	g.DisconnectPlayer(alice)
+	_, err = g.ConnectPlayer("alice", alice.secret, RolePlayer)
+	require.NoError(t, err)
+
+	require.Equal(t, int64(1), g.Stats().RejectedPlayers)
+	drain(out)
+}
+
+func TestStateSizeCapRejectsGrowthAndRollsBack(t *testing.T) {
+	g, out := NewGame(Config{Limits: Limits{MaxStateBytes: 2048}})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(alice, Message{
+		Type:  "update",
+		Value: json.RawMessage(`{"cards":{"c1":{"position":[1,2,3]}}}`),
+	})
+	nextOfType(t, out, "update")
+
+	g.mu.Lock()
+	before, _ := json.Marshal(g.Data)
+	g.mu.Unlock()
+
+	big := `{"cards":{"c1":{"position":[4,5,6]},"c2":{"faceImageUrl":"` + strings.Repeat("x", 4096) + `"}}}`
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(big)})
+	pm, m := nextOfType(t, out, "error")
+	require.Equal(t, []string{"alice"}, pm.To)
+	require.Equal(t, "state_too_large", errorCode(t, m))
+	require.Empty(t, out, "a refused update is not relayed")
+
+	// nothing of the refused patch stuck, not even the part that fit
+	g.mu.Lock()
+	after, _ := json.Marshal(g.Data)
+	g.mu.Unlock()
+	require.JSONEq(t, string(before), string(after))
+	require.Equal(t, int64(1), g.Stats().RejectedUpdates)
+}
+
+func TestStateSizeCapStillAllowsMovesAndDeletes(t *testing.T) {
+	g, out := NewGame(Config{Limits: Limits{MaxStateBytes: 1 << 20}})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	g.HandleMessage(alice, Message{
+		Type:  "update",
+		Value: json.RawMessage(`{"cards":{"c1":{"position":[1,2,3]},"c2":{"faceImageUrl":"` + strings.Repeat("x", 4096) + `"}}}`),
+	})
+	drain(out)
+
+	// the cap drops below what the table already holds, e.g. after a config change
+	g.mu.Lock()
+	g.limits.MaxStateBytes = 1024
+	g.mu.Unlock()
+
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(`{"cards":{"c1":{"position":[7,8,9]}}}`)})
+	nextOfType(t, out, "update")
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(`{"cards":{"c2":null}}`)})
+	nextOfType(t, out, "update")
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	require.NotContains(t, g.Data["cards"], "c2")
+	require.Equal(t, int64(0), g.rejectedUpdates)
+}
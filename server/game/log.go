@@ -0,0 +1,255 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogEntry is one line of the game log: a plain-language account of something
+// a player or the server did, derived from the patches and actions the game
+// applied. Entries never name a card that went somewhere private — a draw is
+// "drew 2 from deck", not which two.
+type LogEntry struct {
+	ID        int64  `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+	Player    string `json:"player,omitempty"`
+	// Kind groups entries for clients that style or filter them: draw, deal,
+	// deck, shuffle, tray, play, roll, counter, join, leave, role, kick, reset,
+	// turn, clock, seat, lobby
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+// logLine is an entry before it is stamped.
+type logLine struct {
+	kind string
+	text string
+}
+
+// Log returns the game log, oldest first.
+func (g *Game) Log() []LogEntry {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]LogEntry(nil), g.gameLog...)
+}
+
+// recordLocked appends lines to the bounded log and returns the log message
+// to broadcast, or nil when there is nothing to say. Caller must hold g.mu.
+func (g *Game) recordLocked(player string, lines ...logLine) []byte {
+	if len(lines) == 0 {
+		return nil
+	}
+	now := time.Now().UnixMilli()
+	entries := make([]LogEntry, 0, len(lines))
+	for _, l := range lines {
+		g.logSeq++
+		entries = append(entries, LogEntry{
+			ID:        g.logSeq,
+			Timestamp: now,
+			Player:    player,
+			Kind:      l.kind,
+			Text:      l.text,
+		})
+	}
+	g.gameLog = append(g.gameLog, entries...)
+	if over := len(g.gameLog) - g.logHistory; over > 0 {
+		g.gameLog = append(g.gameLog[:0], g.gameLog[over:]...)
+	}
+
+	value, _ := json.Marshal(map[string]any{"entries": entries})
+	payload, _ := json.Marshal(Message{
+		Type:      "log",
+		PlayerID:  player,
+		Timestamp: now,
+		Value:     value,
+	})
+	return payload
+}
+
+// sendLog broadcasts a log message without blocking — it is sent from timer
+// goroutines and after kicks, like presence — and, like presence, flags a
+// dropped line for a re-sync (see offer).
+func (g *Game) sendLog(payload []byte) {
+	if payload == nil {
+		return
+	}
+	g.offer(&PlayerMessage{To: []string{}, Content: payload, Type: "log"})
+}
+
+// describePatch phrases what actor's patch does to before, the state it is
+// about to be merged into. It only looks at the parts of the table whose
+// meaning the server knows — decks, table cards, trays and pieces — and says
+// nothing about the rest.
+//
+// Cards moving into a tray are only ever counted: the patch carries their
+// faces, but the log is public.
+func describePatch(actor string, before, patch map[string]any) []logLine {
+	var lines []logLine
+	name := displayName(object(before, "players"), actor)
+
+	// cards entering and leaving the actor's own tray
+	beforeTray := object(object(object(before, "players"), actor), "tray")
+	trayIn, trayOut := 0, 0
+	for id, v := range object(object(object(patch, "players"), actor), "tray") {
+		_, had := beforeTray[id]
+		switch {
+		case v == nil && had:
+			trayOut++
+		case v != nil && !had:
+			trayIn++
+		}
+	}
+
+	beforeCards := object(before, "cards")
+	tableIn := 0
+	for _, id := range sortedKeys(object(patch, "cards")) {
+		if _, had := beforeCards[id]; !had && object(patch, "cards")[id] != nil {
+			tableIn++
+		}
+	}
+
+	beforeDecks := object(before, "decks")
+	patchDecks := object(patch, "decks")
+	for _, id := range sortedKeys(patchDecks) {
+		old, existed := beforeDecks[id].(map[string]any)
+		deck, _ := patchDecks[id].(map[string]any)
+		switch {
+		case patchDecks[id] == nil:
+			if existed {
+				lines = append(lines, logLine{"deck", fmt.Sprintf("%s removed %s", name, id)})
+			}
+			continue
+		case deck == nil:
+			continue
+		case !existed:
+			cards, _ := deck["cards"].([]any)
+			lines = append(lines, logLine{"deck", fmt.Sprintf("%s added %s (%s)", name, id, plural(len(cards), "card"))})
+			continue
+		}
+
+		if cards, ok := deck["cards"].([]any); ok {
+			oldCards, _ := old["cards"].([]any)
+			switch n := len(oldCards) - len(cards); {
+			case n > 0 && trayIn > 0:
+				lines = append(lines, logLine{"draw", fmt.Sprintf("%s drew %d from %s", name, n, id)})
+				trayIn -= min(n, trayIn)
+			case n > 0 && tableIn > 0:
+				lines = append(lines, logLine{"deal", fmt.Sprintf("%s dealt %d from %s to the table", name, n, id)})
+				tableIn -= min(n, tableIn)
+			case n > 0:
+				lines = append(lines, logLine{"deck", fmt.Sprintf("%s took %d from %s", name, n, id)})
+			case n < 0:
+				lines = append(lines, logLine{"deck", fmt.Sprintf("%s put %s into %s", name, plural(-n, "card"), id)})
+			}
+		}
+		if at, ok := deck["shuffledAt"]; ok && !reflect.DeepEqual(at, old["shuffledAt"]) {
+			lines = append(lines, logLine{"shuffle", fmt.Sprintf("%s shuffled %s", name, id)})
+		}
+	}
+
+	// whatever tray traffic the decks did not explain went to or came from
+	// the table
+	patchCards := object(patch, "cards")
+	for _, id := range sortedKeys(patchCards) {
+		_, had := beforeCards[id]
+		switch {
+		case patchCards[id] == nil && had && trayIn > 0:
+			lines = append(lines, logLine{"tray", fmt.Sprintf("%s moved a card to their tray", name)})
+			trayIn--
+		case patchCards[id] != nil && !had && trayOut > 0:
+			lines = append(lines, logLine{"play", fmt.Sprintf("%s played a card from their tray", name)})
+			trayOut--
+		}
+	}
+
+	beforePieces := object(before, "pieces")
+	patchPieces := object(patch, "pieces")
+	for _, id := range sortedKeys(patchPieces) {
+		piece, _ := patchPieces[id].(map[string]any)
+		old, _ := beforePieces[id].(map[string]any)
+		if piece == nil || old == nil {
+			continue
+		}
+		kind, _ := pick(piece, old, "kind").(string)
+		switch kind {
+		case "die":
+			if seq, ok := piece["rollSeq"]; !ok || reflect.DeepEqual(seq, old["rollSeq"]) {
+				continue
+			}
+			lines = append(lines, logLine{"roll", fmt.Sprintf("%s rolled d%s → %s",
+				name, number(pick(piece, old, "sides")), number(pick(piece, old, "value")))})
+		case "counter":
+			if v, ok := piece["value"]; ok && !reflect.DeepEqual(v, old["value"]) {
+				lines = append(lines, logLine{"counter", fmt.Sprintf("%s set %s to %s", name, pieceName(id, piece, old), number(v))})
+			}
+		}
+	}
+	return lines
+}
+
+// displayName is how the log refers to a player id: by the name on their
+// row in players, falling back to the id.
+func displayName(players map[string]any, id string) string {
+	if id == "" {
+		return AdminID
+	}
+	if name, _ := object(players, id)["name"].(string); strings.TrimSpace(name) != "" {
+		return strings.TrimSpace(name)
+	}
+	return id
+}
+
+// pieceName is a piece's name, falling back to its id.
+func pieceName(id string, piece, old map[string]any) string {
+	if name, _ := pick(piece, old, "name").(string); name != "" {
+		return name
+	}
+	return id
+}
+
+// pick returns key from patch when the patch sets it, else from before.
+func pick(patch, before map[string]any, key string) any {
+	if v, ok := patch[key]; ok {
+		return v
+	}
+	return before[key]
+}
+
+// object returns m[key] as an object, or nil.
+func object(m map[string]any, key string) map[string]any {
+	v, _ := m[key].(map[string]any)
+	return v
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// number formats a decoded JSON number without a trailing ".0".
+func number(v any) string {
+	switch n := v.(type) {
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	case nil:
+		return "?"
+	default:
+		return fmt.Sprint(n)
+	}
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return strconv.Itoa(n) + " " + noun + "s"
+}
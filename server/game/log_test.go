@@ -0,0 +1,101 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func logTexts(g *Game) []string {
+	var texts []string
+	for _, e := range g.Log() {
+		texts = append(texts, e.Text)
+	}
+	return texts
+}
+
+func TestDrawIsLoggedWithoutNamingTheCard(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	require.NoError(t, g.Patch(json.RawMessage(`{"decks":{"deck:alice:main":{"cards":[{"id":"ace"},{"id":"king"},{"id":"queen"}]}}}`)))
+	drain(out)
+
+	g.HandleMessage(alice, Message{
+		Type:  "update",
+		Value: json.RawMessage(`{"decks":{"deck:alice:main":{"cards":[{"id":"queen"}]}},"players":{"alice":{"tray":{"ace":{"face":"ace"},"king":{"face":"king"}}}}}`),
+	})
+	_, m := nextOfType(t, out, "log")
+	require.Contains(t, string(m.Value), "alice drew 2 from deck:alice:main")
+	require.NotContains(t, string(m.Value), "ace")
+	require.NotContains(t, string(m.Value), "king")
+
+	entries := g.Log()
+	last := entries[len(entries)-1]
+	require.Equal(t, "draw", last.Kind)
+	require.Equal(t, "alice", last.Player)
+}
+
+func TestTableMovesRollsAndCountersAreLogged(t *testing.T) {
+	g, out := NewGame(Config{})
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	require.NoError(t, g.Patch(json.RawMessage(`{
+		"cards":{"c1":{"position":[0,0,0]}},
+		"pieces":{"d20":{"kind":"die","sides":20,"value":1,"rollSeq":1},"hp":{"kind":"counter","name":"Life","value":20}}
+	}`)))
+	drain(out)
+
+	updates := []string{
+		`{"cards":{"c1":null},"players":{"bob":{"tray":{"c1":{"face":"secret"}}}}}`,
+		`{"cards":{"c1":{"position":[1,0,1]}},"players":{"bob":{"tray":{"c1":null}}}}`,
+		`{"pieces":{"d20":{"value":17,"rollSeq":2}}}`,
+		`{"pieces":{"d20":{"position":[2,0,2]}}}`, // moving a die is not a roll
+		`{"pieces":{"hp":{"value":18}}}`,
+	}
+	for _, u := range updates {
+		g.HandleMessage(bob, Message{Type: "update", Value: json.RawMessage(u)})
+	}
+	require.Equal(t, []string{
+		"bob joined",
+		"bob moved a card to their tray",
+		"bob played a card from their tray",
+		"bob rolled d20 → 17",
+		"bob set Life to 18",
+	}, logTexts(g))
+}
+
+func TestLogUsesThePlayersName(t *testing.T) {
+	g, out := NewGame(Config{})
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	require.NoError(t, g.Patch(json.RawMessage(`{"cards":{"c1":{"position":[0,0,0]}}}`)))
+
+	g.HandleMessage(bob, Message{Type: "update", Value: json.RawMessage(`{"cards":{"c1":null},"players":{"bob":{"tray":{"c1":{"face":"x"}}}}}`)})
+	g.HandleMessage(bob, Message{Type: "update", Value: json.RawMessage(`{"players":{"bob":{"name":"Bobbi"}}}`)})
+	g.HandleMessage(bob, Message{Type: "update", Value: json.RawMessage(`{"cards":{"c1":{"position":[1,0,1]}},"players":{"bob":{"tray":{"c1":null}}}}`)})
+	drain(out)
+	require.Equal(t, []string{
+		"bob joined",
+		"bob moved a card to their tray",
+		"Bobbi played a card from their tray",
+	}, logTexts(g))
+}
+
+func TestActionsAreLoggedAndHistoryIsBounded(t *testing.T) {
+	g, out := NewGame(Config{LogHistory: 3})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RoleSpectator)
+	mustConnect(t, g, "carol", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "setRole", Value: json.RawMessage(`{"player":"carol","role":"spectator"}`)})
+	g.HandleMessage(alice, Message{Type: "kick", Value: json.RawMessage(`{"player":"bob"}`)})
+	g.HandleMessage(alice, Message{Type: "reset"})
+
+	require.Equal(t, []string{
+		"alice made carol a spectator",
+		"bob was kicked",
+		"alice reset the table",
+	}, logTexts(g))
+	entries := g.Log()
+	require.Less(t, entries[0].ID, entries[2].ID)
+}
@@ -0,0 +1,111 @@
+package game
+
+// serverOwnedFields are the players[id] fields only the server writes. Client
+// patches carrying them have those fields dropped before the merge.
+var serverOwnedFields = []string{"connected", "joinTimestamp", "role"}
+
+// serverOwnedKeys are the top-level keys only the server writes, dropped
+// from client patches the same way.
+var serverOwnedKeys = []string{"turn", "clocks", "seats", "lobby"}
+
+// authorizePatch enforces who may write which part of a client update, editing
+// patch in place:
+//
+//   - a player may patch only the players[id] rows they own: their own, and
+//     the placeholder of the seat they hold. Only the host may touch (or
+//     delete) a row someone else owns. A row nobody owns — an open seat's
+//     placeholder — is table state anyone may write, as claiming a
+//     placeholder's seat clears its row
+//   - server-owned fields are dropped from every row, whoever sent them
+//   - server-owned top-level keys are dropped, whoever sent them
+//
+// It returns a reason when the whole update must be rejected, and reports
+// whether anything was dropped so the caller can re-encode what it relays.
+// Everything outside players stays shared table state anyone may move.
+// rowOwner says who owns a row (see rowOwnerLocked); nil, for a whole new
+// table, means nobody does.
+func authorizePatch(fromID string, role Role, rowOwner func(id string) string, patch map[string]any) (stripped bool, reason string) {
+	for _, k := range serverOwnedKeys {
+		if _, ok := patch[k]; ok {
+			delete(patch, k)
+			stripped = true
+		}
+	}
+	raw, ok := patch["players"]
+	if !ok {
+		return stripped, ""
+	}
+	rows, ok := raw.(map[string]any)
+	if !ok {
+		// "players": null (or a scalar) would wipe every row at once
+		return false, "cannot replace the players table"
+	}
+
+	for id, row := range rows {
+		if rowOwner != nil && role != RoleHost {
+			if owner := rowOwner(id); owner != "" && owner != fromID {
+				return false, "cannot modify another player's data: " + id
+			}
+		}
+		if row == nil {
+			if id == fromID {
+				return false, "cannot delete your own player row"
+			}
+			continue // the host clearing someone's row
+		}
+		fields, ok := row.(map[string]any)
+		if !ok {
+			return false, "player row must be an object: " + id
+		}
+		for _, f := range serverOwnedFields {
+			if _, ok := fields[f]; ok {
+				delete(fields, f)
+				stripped = true
+			}
+		}
+		if len(fields) == 0 {
+			delete(rows, id)
+		}
+	}
+	if len(rows) == 0 {
+		delete(patch, "players")
+	}
+	return stripped, ""
+}
+
+// rowOwnerLocked returns who owns the players[id] row: the player with that
+// id, or for a scenario's seat placeholder — a row that is not a player's,
+// keyed by its seat number — whoever sits in that seat. "" means nobody does.
+// Caller must hold g.mu.
+func (g *Game) rowOwnerLocked(id string) string {
+	if _, ok := g.Players[id]; ok {
+		return id
+	}
+	row, _ := object(g.Data, "players")[id].(map[string]any)
+	seat, ok := row["seat"].(float64)
+	if !ok {
+		return ""
+	}
+	for pid, p := range g.Players {
+		if p.Seat != NoSeat && float64(p.Seat) == seat {
+			return pid
+		}
+	}
+	return ""
+}
+
+// serverRowLocked is the server-owned part of p's players[id] row. Spectators
+// get no joinTimestamp — the HUD only renders rows that have one — so a null
+// here removes it when a player is moved to the stands. Caller must hold g.mu.
+func serverRowLocked(p *Player) map[string]any {
+	row := map[string]any{
+		"connected":     p.Connected,
+		"role":          string(p.Role),
+		"joinTimestamp": nil,
+	}
+	if p.Role != RoleSpectator {
+		// float64, like every number decoded from a client patch
+		row["joinTimestamp"] = float64(p.JoinTimestamp)
+	}
+	return row
+}
@@ -0,0 +1,179 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func playerRow(t *testing.T, g *Game, id string) map[string]any {
+	t.Helper()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	row, _ := g.Data["players"].(map[string]any)[id].(map[string]any)
+	return row
+}
+
+func TestPlayerCannotWriteAnotherPlayersRow(t *testing.T) {
+	g, out := NewGame(Config{})
+	mustConnect(t, g, "alice", RolePlayer) // host
+	mustConnect(t, g, "bob", RolePlayer)
+	carol := mustConnect(t, g, "carol", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(carol, Message{
+		Type:  "update",
+		Value: json.RawMessage(`{"cards":{"c1":{"position":[1,2,3]}},"players":{"bob":{"connected":false,"tray":null}}}`),
+	})
+	pm, m := nextOfType(t, out, "error")
+	require.Equal(t, []string{"carol"}, pm.To)
+	require.Equal(t, "forbidden", errorCode(t, m))
+	require.Empty(t, out, "a rejected update must not be relayed")
+
+	// the whole update is refused, table part included
+	g.mu.Lock()
+	require.NotContains(t, g.Data, "cards")
+	g.mu.Unlock()
+	require.Equal(t, true, playerRow(t, g, "bob")["connected"])
+}
+
+func TestOwnRowWritesDropServerOwnedFields(t *testing.T) {
+	g, out := NewGame(Config{})
+	mustConnect(t, g, "alice", RolePlayer)
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+	joined := playerRow(t, g, "bob")["joinTimestamp"]
+
+	g.HandleMessage(bob, Message{
+		Type:  "update",
+		Value: json.RawMessage(`{"players":{"bob":{"connected":false,"joinTimestamp":1,"role":"host","seat":2}}}`),
+	})
+	_, m := nextOfType(t, out, "update")
+	require.JSONEq(t, `{"players":{"bob":{"seat":2}},"seats":{"taken":{"2":"bob"}}}`, string(m.Value),
+		"peers receive the patch as merged, not as sent — a seat write is a claim")
+
+	row := playerRow(t, g, "bob")
+	require.Equal(t, true, row["connected"])
+	require.Equal(t, joined, row["joinTimestamp"])
+	require.Equal(t, "player", row["role"])
+	require.Equal(t, float64(2), row["seat"])
+	require.Equal(t, RolePlayer, bob.Role)
+}
+
+func TestUpdateOfOnlyServerOwnedFieldsIsDropped(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	drain(out)
+	updates := g.Updates
+
+	g.HandleMessage(alice, Message{
+		Type:  "update",
+		Value: json.RawMessage(`{"players":{"alice":{"connected":false}}}`),
+	})
+	require.Empty(t, out)
+	require.Equal(t, updates, g.Updates)
+}
+
+func TestHostMayWriteOtherRowsButNotServerOwnedFields(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer) // host
+	mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(alice, Message{
+		Type:  "update",
+		Value: json.RawMessage(`{"players":{"bob":{"connected":false,"tray":{"c1":{}}}}}`),
+	})
+	_, m := nextOfType(t, out, "update")
+	require.JSONEq(t, `{"players":{"bob":{"tray":{"c1":{}}}}}`, string(m.Value))
+
+	row := playerRow(t, g, "bob")
+	require.Equal(t, true, row["connected"])
+	require.Contains(t, row["tray"], "c1")
+}
+
+func TestPlayersTableCannotBeReplaced(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer) // even the host
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(`{"players":null}`)})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "forbidden", errorCode(t, m))
+	require.NotNil(t, playerRow(t, g, "alice"))
+}
+
+func TestReturningPlayerKeepsStoredJoinTimestamp(t *testing.T) {
+	g, out := NewGame(Config{})
+	g.Data = map[string]any{
+		"players": map[string]any{"alice": map[string]any{"joinTimestamp": float64(10)}},
+	}
+
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	drain(out)
+	require.Equal(t, int64(10), alice.JoinTimestamp)
+	require.Equal(t, float64(10), playerRow(t, g, "alice")["joinTimestamp"])
+}
+
+func TestSpectatorRowHasNoJoinTimestamp(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+	require.Contains(t, playerRow(t, g, "bob"), "joinTimestamp")
+
+	// moving bob to the stands takes their row off the HUD
+	g.HandleMessage(alice, Message{Type: "setRole", Value: json.RawMessage(`{"player":"bob","role":"spectator"}`)})
+	drain(out)
+	row := playerRow(t, g, "bob")
+	require.NotContains(t, row, "joinTimestamp")
+	require.Equal(t, "spectator", row["role"])
+}
+
+func TestPlayerMayClaimAPlaceholderSeat(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer) // host
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(`{"players":{"seat1":{"seat":1,"tray":{}}}}`)})
+	drain(out)
+
+	// what the client's claimSeat sends: the placeholder's row goes, with
+	// the renamed table state, in the same update as the claimant's seat
+	g.HandleMessage(bob, Message{
+		Type:  "update",
+		Value: json.RawMessage(`{"pieces":{"piece:seat1:p-0":null,"piece:bob:p-0":{"kind":"pawn"}},"players":{"seat1":null,"bob":{"seat":1,"tray":{}}}}`),
+	})
+	_, m := nextOfType(t, out, "update")
+	require.Equal(t, "bob", m.PlayerID)
+	g.mu.Lock()
+	require.NotContains(t, g.Data["players"], "seat1")
+	require.Contains(t, g.Data["pieces"], "piece:bob:p-0")
+	g.mu.Unlock()
+	require.Equal(t, float64(1), playerRow(t, g, "bob")["seat"])
+}
+
+func TestSeatPlaceholderBelongsToWhoeverHoldsTheSeat(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer) // host
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	carol := mustConnect(t, g, "carol", RolePlayer)
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(`{"players":{"seat1":{"seat":1,"tray":{}}}}`)})
+	g.HandleMessage(bob, Message{Type: "claimSeat", Value: json.RawMessage(`{"seat":1}`)})
+	drain(out)
+
+	g.HandleMessage(carol, Message{Type: "update", Value: json.RawMessage(`{"players":{"seat1":{"tray":{"c1":{}}}}}`)})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "forbidden", errorCode(t, m), "seat 1 is bob's now")
+
+	g.HandleMessage(bob, Message{Type: "update", Value: json.RawMessage(`{"players":{"seat1":{"tray":{"c1":{}}}}}`)})
+	nextOfType(t, out, "update")
+	require.Equal(t, map[string]any{"c1": map[string]any{}}, playerRow(t, g, "seat1")["tray"])
+
+	// once bob stands up the placeholder is open table state again
+	g.HandleMessage(bob, Message{Type: "releaseSeat"})
+	drain(out)
+	g.HandleMessage(carol, Message{Type: "update", Value: json.RawMessage(`{"players":{"seat1":null}}`)})
+	nextOfType(t, out, "update")
+	require.Nil(t, playerRow(t, g, "seat1"))
+}
@@ -9,8 +9,8 @@ import (
 )
 
 // drain empties the out channel and returns the decoded presence patches, in
-// order. Non-update messages fail the test — presence must ride the ordinary
-// update channel.
+// order. Game log lines are skipped; any other non-update message fails the
+// test — presence must ride the ordinary update channel.
 func drainPresence(t *testing.T, out <-chan *PlayerMessage) []map[string]any {
 	t.Helper()
 	var patches []map[string]any
@@ -19,6 +19,9 @@ func drainPresence(t *testing.T, out <-chan *PlayerMessage) []map[string]any {
 		case msg := <-out:
 			var m Message
 			require.NoError(t, json.Unmarshal(msg.Content, &m))
+			if m.Type == "log" {
+				continue
+			}
 			require.Equal(t, "update", m.Type)
 			var patch map[string]any
 			require.NoError(t, json.Unmarshal(m.Value, &patch))
@@ -39,9 +42,9 @@ func connectedValue(t *testing.T, patch map[string]any, id string) any {
 }
 
 func TestConnectBroadcastsPresencePatch(t *testing.T) {
-	g, out := NewGame()
+	g, out := NewGame(Config{})
 
-	g.ConnectPlayer("alice")
+	mustConnect(t, g, "alice", RolePlayer)
 
 	patches := drainPresence(t, out)
 	require.Len(t, patches, 1)
@@ -53,7 +56,7 @@ func TestConnectBroadcastsPresencePatch(t *testing.T) {
 }
 
 func TestPresenceMergeKeepsExistingPlayerState(t *testing.T) {
-	g, out := NewGame()
+	g, out := NewGame(Config{})
 	g.offlineGrace = 20 * time.Millisecond
 	// state a client would have written: seat, tray, joinTimestamp
 	g.Data = map[string]any{
@@ -62,7 +65,7 @@ func TestPresenceMergeKeepsExistingPlayerState(t *testing.T) {
 		},
 	}
 
-	p := g.ConnectPlayer("alice")
+	p := mustConnect(t, g, "alice", RolePlayer)
 	g.DisconnectPlayer(p)
 	// wait for the offline broadcast to land in g.Data
 	require.Eventually(t, func() bool {
@@ -82,13 +85,13 @@ func TestPresenceMergeKeepsExistingPlayerState(t *testing.T) {
 }
 
 func TestReconnectInsideGraceNeverBroadcastsOffline(t *testing.T) {
-	g, out := NewGame()
+	g, out := NewGame(Config{})
 	g.offlineGrace = 50 * time.Millisecond
 
-	p := g.ConnectPlayer("alice")
+	p := mustConnect(t, g, "alice", RolePlayer)
 	g.DisconnectPlayer(p)
 	// reconnect well inside the grace period — same id, as a page refresh does
-	g.ConnectPlayer("alice")
+	mustConnect(t, g, "alice", RolePlayer)
 
 	// wait past the (cancelled) grace period, then assert nobody was ever told
 	// alice went offline
@@ -104,10 +107,10 @@ func TestReconnectInsideGraceNeverBroadcastsOffline(t *testing.T) {
 }
 
 func TestDisconnectPastGraceBroadcastsOffline(t *testing.T) {
-	g, out := NewGame()
+	g, out := NewGame(Config{})
 	g.offlineGrace = 20 * time.Millisecond
 
-	p := g.ConnectPlayer("alice")
+	p := mustConnect(t, g, "alice", RolePlayer)
 	drainPresence(t, out) // discard the connect patch
 
 	g.DisconnectPlayer(p)
@@ -129,12 +132,12 @@ func TestDisconnectPastGraceBroadcastsOffline(t *testing.T) {
 // A reconnect can attach the new socket before the old one's close is
 // noticed. The stale disconnect must not mark the player offline.
 func TestStaleDisconnectAfterReconnectKeepsPlayerOnline(t *testing.T) {
-	g, out := NewGame()
+	g, out := NewGame(Config{})
 	g.offlineGrace = 20 * time.Millisecond
 
-	p := g.ConnectPlayer("alice") // original socket
-	g.ConnectPlayer("alice")      // new socket attaches first…
-	g.DisconnectPlayer(p)         // …then the old socket's close lands
+	p := mustConnect(t, g, "alice", RolePlayer) // original socket
+	mustConnect(t, g, "alice", RolePlayer)      // new socket attaches first…
+	g.DisconnectPlayer(p)                       // …then the old socket's close lands
 
 	time.Sleep(100 * time.Millisecond)
 	for _, patch := range drainPresence(t, out) {
@@ -142,3 +145,28 @@ func TestStaleDisconnectAfterReconnectKeepsPlayerOnline(t *testing.T) {
 	}
 	require.True(t, g.Players["alice"].Connected)
 }
+
+func TestDroppedPresenceIsFlagged(t *testing.T) {
+	g, out := NewGame(Config{OutBuffer: 2})
+	mustConnect(t, g, "alice", RolePlayer) // presence and the join line fill the channel
+	require.False(t, g.TakeDropped())
+
+	mustConnect(t, g, "bob", RolePlayer) // nowhere to go
+	require.Len(t, out, 2)
+	require.True(t, g.TakeDropped(), "the lobby must learn everyone missed bob arriving")
+	require.False(t, g.TakeDropped(), "taking clears the flag")
+}
+
+func TestEveryDroppedBroadcastIsFlagged(t *testing.T) {
+	g, out := NewGame(Config{OutBuffer: 2})
+	mustConnect(t, g, "alice", RolePlayer) // presence and the join line fill the channel
+	require.False(t, g.TakeDropped())
+
+	// a log line, a clockExpired, a revealEnd and a place in line all go
+	// through offer; none may vanish without the lobby hearing of it
+	g.sendLog([]byte(`{"type":"log"}`))
+	require.True(t, g.TakeDropped())
+	g.revealEnded("alice", "c1", []string{"bob"})
+	require.True(t, g.TakeDropped())
+	require.Len(t, out, 2)
+}
@@ -0,0 +1,286 @@
+package game
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Bounds on the private actions.
+const (
+	maxPeek       = 10 // cards one peek may look at
+	defaultReveal = 10 * time.Second
+	maxReveal     = 5 * time.Minute
+)
+
+// privateValue is the payload of peek and reveal; each reads only its fields.
+type privateValue struct {
+	// peek: the deck and how many cards off its top, 1 by default
+	Deck  string `json:"deck,omitempty"`
+	Count int    `json:"count,omitempty"`
+	// reveal: the id of a card in the sender's tray, who to show it to, and
+	// for how long in milliseconds, defaultReveal by default
+	Card     string   `json:"card,omitempty"`
+	To       []string `json:"to,omitempty"`
+	Duration int64    `json:"duration,omitempty"`
+}
+
+// private handles peek and reveal. What was seen goes only to the players
+// who may see it, through PlayerMessage.To; the rest of the table learns
+// from the log that it happened, never what it was.
+func (g *Game) private(from *Player, msg Message) {
+	var v privateValue
+	if msg.Value == nil || json.Unmarshal(msg.Value, &v) != nil {
+		g.sendError(from.ID, msg.Type, "invalid", "malformed "+msg.Type)
+		return
+	}
+
+	g.mu.Lock()
+	var (
+		pm   *PlayerMessage
+		line logLine
+		err  *rejection
+	)
+	switch msg.Type {
+	case "peek":
+		pm, line, err = g.peekLocked(from, v)
+	case "reveal":
+		pm, line, err = g.revealLocked(from, v)
+	}
+	if err != nil {
+		g.mu.Unlock()
+		g.sendError(from.ID, msg.Type, err.code, err.Error())
+		return
+	}
+	logged := g.recordLocked(from.ID, line)
+	g.LastActivity = time.Now()
+	g.mu.Unlock()
+
+	g.send(pm)
+	g.sendLog(logged)
+}
+
+// peekLocked reads the top of a deck for the sender alone: a peek message
+// with the cards, the top one first. The top of a face-down deck is the end
+// of its cards, of a face-up one the start, as clients draw them. A player
+// may peek at their own decks, their seat's, and the table's — those nobody
+// owns. Caller must hold g.mu.
+func (g *Game) peekLocked(from *Player, v privateValue) (*PlayerMessage, logLine, *rejection) {
+	deck, ok := object(g.Data, "decks")[v.Deck].(map[string]any)
+	if !ok {
+		return nil, logLine{}, &rejection{"unknown_deck", fmt.Errorf("no such deck: %s", v.Deck)}
+	}
+	if owner := g.rowOwnerLocked(ownerOf(v.Deck)); owner != "" && owner != from.ID {
+		return nil, logLine{}, &rejection{"forbidden", fmt.Errorf("%s is %s's deck", v.Deck, owner)}
+	}
+	count := v.Count
+	if count == 0 {
+		count = 1
+	}
+	if count < 0 || count > maxPeek {
+		return nil, logLine{}, &rejection{"invalid", fmt.Errorf("can peek at 1 to %d cards", maxPeek)}
+	}
+	cards, _ := deck["cards"].([]any)
+	count = min(count, len(cards))
+	if count == 0 {
+		return nil, logLine{}, &rejection{"invalid", fmt.Errorf("%s is empty", v.Deck)}
+	}
+	top := slices.Clone(cards[:count])
+	if faceUp, _ := deck["isFaceUp"].(bool); !faceUp {
+		top = slices.Clone(cards[len(cards)-count:])
+		slices.Reverse(top)
+	}
+
+	value, _ := json.Marshal(map[string]any{"deck": v.Deck, "cards": top})
+	payload, _ := json.Marshal(Message{
+		Type:      "peek",
+		PlayerID:  from.ID,
+		Timestamp: time.Now().UnixMilli(),
+		Value:     value,
+	})
+	line := logLine{"peek", fmt.Sprintf("%s peeked at the top card of %s", from.ID, v.Deck)}
+	if count > 1 {
+		line.text = fmt.Sprintf("%s peeked at the top %d cards of %s", from.ID, count, v.Deck)
+	}
+	return &PlayerMessage{To: []string{from.ID}, Content: payload, Type: "peek"}, line, nil
+}
+
+// revealLocked shows a card in the sender's tray to the players in v.To
+// with a reveal message carrying the card and when the reveal ends. At that
+// time they are sent a revealEnd, and clients put the card away again.
+// Caller must hold g.mu.
+func (g *Game) revealLocked(from *Player, v privateValue) (*PlayerMessage, logLine, *rejection) {
+	tray := object(object(object(g.Data, "players"), from.ID), "tray")
+	card, ok := tray[v.Card].(map[string]any)
+	if !ok {
+		return nil, logLine{}, &rejection{"unknown_card", fmt.Errorf("not in your tray: %s", v.Card)}
+	}
+	if len(v.To) == 0 {
+		return nil, logLine{}, &rejection{"invalid", errors.New("reveal needs players to show the card to")}
+	}
+	to := make([]string, 0, len(v.To))
+	for _, id := range v.To {
+		if _, ok := g.Players[id]; !ok {
+			return nil, logLine{}, &rejection{"unknown_player", fmt.Errorf("no such player: %s", id)}
+		}
+		if id != from.ID && !slices.Contains(to, id) {
+			to = append(to, id)
+		}
+	}
+	if len(to) == 0 {
+		return nil, logLine{}, &rejection{"invalid", errors.New("reveal needs players other than yourself")}
+	}
+	duration := defaultReveal
+	if v.Duration != 0 {
+		duration = time.Duration(v.Duration) * time.Millisecond
+	}
+	if duration <= 0 || duration > maxReveal {
+		return nil, logLine{}, &rejection{"invalid", fmt.Errorf("a reveal lasts up to %s", maxReveal)}
+	}
+
+	now := g.clock.Now()
+	value, _ := json.Marshal(map[string]any{
+		"player": from.ID,
+		"id":     v.Card,
+		"card":   card,
+		"until":  now.Add(duration).UnixMilli(),
+	})
+	payload, _ := json.Marshal(Message{
+		Type:      "reveal",
+		PlayerID:  from.ID,
+		Timestamp: now.UnixMilli(),
+		Value:     value,
+	})
+	g.clock.AfterFunc(duration, func() { g.revealEnded(from.ID, v.Card, to) })
+
+	names := to[0]
+	if len(to) > 1 {
+		names = plural(len(to), "player")
+	}
+	line := logLine{"reveal", fmt.Sprintf("%s showed a card to %s", from.ID, names)}
+	return &PlayerMessage{To: to, Content: payload, Type: "reveal"}, line, nil
+}
+
+// revealEnded tells the players a card was shown to that the reveal is over.
+func (g *Game) revealEnded(player, card string, to []string) {
+	if g.closed() {
+		return
+	}
+	value, _ := json.Marshal(map[string]string{"player": player, "id": card})
+	payload, _ := json.Marshal(Message{
+		Type:      "revealEnd",
+		PlayerID:  player,
+		Timestamp: g.clock.Now().UnixMilli(),
+		Value:     value,
+	})
+	// from a timer goroutine, so never block; the reveal carried its end time
+	// for clients that miss this
+	if !g.offer(&PlayerMessage{To: to, Content: payload, Type: "revealEnd"}) {
+		log.Warn().Str("player", player).Msg("game out channel full, dropping revealEnd")
+	}
+}
+
+// hideTrays returns data as player id may see it: every other player's tray
+// keeps its cards' ids, so clients can count a hand, but not what is on them
+// — a reveal is the only way to show one. A seat placeholder's tray is not
+// anyone's hand yet and stays as it is. data is shared, not copied, but for
+// the maps on the way to a hidden tray.
+func hideTrays(data map[string]any, id string, players map[string]*Player) map[string]any {
+	rows := object(data, "players")
+	var hidden map[string]any
+	for pid, raw := range rows {
+		row, _ := raw.(map[string]any)
+		tray := object(row, "tray")
+		if _, player := players[pid]; !player || pid == id || len(tray) == 0 {
+			continue
+		}
+		if hidden == nil {
+			hidden = maps.Clone(rows)
+		}
+		cards := make(map[string]any, len(tray))
+		for card, v := range tray {
+			if v != nil {
+				v = map[string]any{}
+			}
+			cards[card] = v
+		}
+		row = maps.Clone(row)
+		row["tray"] = cards
+		hidden[pid] = row
+	}
+	if hidden == nil {
+		return data
+	}
+	data = maps.Clone(data)
+	data["players"] = hidden
+	return data
+}
+
+// trayOwners returns the players whose tray cards patch carries, and patch
+// with those cards hidden as hideTrays hides them; nil for a patch that puts
+// nothing in a player's tray.
+func trayOwners(patch json.RawMessage, players map[string]*Player) (owners []string, hidden json.RawMessage) {
+	if !bytes.Contains(patch, []byte(`"tray"`)) {
+		return nil, nil
+	}
+	var v map[string]any
+	if json.Unmarshal(patch, &v) != nil {
+		return nil, nil
+	}
+	for _, pid := range sortedKeys(object(v, "players")) {
+		if _, player := players[pid]; !player {
+			continue
+		}
+		for _, card := range object(object(object(v, "players"), pid), "tray") {
+			if card != nil {
+				owners = append(owners, pid)
+				break
+			}
+		}
+	}
+	if len(owners) == 0 {
+		return nil, nil
+	}
+	hidden, _ = json.Marshal(hideTrays(v, "", players))
+	return owners, hidden
+}
+
+// relayUpdate broadcasts an update to the lobby, all but exclude: as it is to
+// the players whose trays it fills, with those trays hidden to everyone else.
+func (g *Game) relayUpdate(msg Message, exclude string) {
+	g.mu.Lock()
+	owners, hidden := trayOwners(msg.Value, g.Players)
+	if owners == nil {
+		g.mu.Unlock()
+		data, _ := json.Marshal(msg)
+		g.send(&PlayerMessage{To: []string{}, Exclude: exclude, Content: data, Type: msg.Type})
+		return
+	}
+	var shown, others []string
+	for id := range g.Players {
+		switch {
+		case id == exclude:
+		case slices.Contains(owners, id):
+			shown = append(shown, id)
+		default:
+			others = append(others, id)
+		}
+	}
+	g.mu.Unlock()
+	// an empty To is everyone: only send to someone
+	if len(shown) > 0 {
+		data, _ := json.Marshal(msg)
+		g.send(&PlayerMessage{To: shown, Content: data, Type: msg.Type})
+	}
+	if len(others) > 0 {
+		msg.Value = hidden
+		data, _ := json.Marshal(msg)
+		g.send(&PlayerMessage{To: others, Content: data, Type: msg.Type})
+	}
+}
@@ -0,0 +1,116 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jollygrin/tts-server/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeekGoesOnlyToThePeeker(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RolePlayer)
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(
+		`{"decks":{"deck:alice:1":{"cards":[{"id":"a"},{"id":"b"},{"id":"c"},{"id":"d"}]},"discard":{"isFaceUp":true,"cards":[{"id":"x"},{"id":"y"}]}}}`)})
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "peek", Value: json.RawMessage(`{"deck":"deck:alice:1","count":3}`)})
+	pm, m := nextOfType(t, out, "peek")
+	require.Equal(t, []string{"alice"}, pm.To)
+	require.JSONEq(t, `{"deck":"deck:alice:1","cards":[{"id":"d"},{"id":"c"},{"id":"b"}]}`, string(m.Value), "top card first")
+	_, m = nextOfType(t, out, "log")
+	require.Contains(t, string(m.Value), "alice peeked at the top 3 cards of deck:alice:1")
+	require.NotContains(t, string(m.Value), `"d"`)
+
+	g.HandleMessage(alice, Message{Type: "peek", Value: json.RawMessage(`{"deck":"discard"}`)})
+	_, m = nextOfType(t, out, "peek")
+	require.JSONEq(t, `{"deck":"discard","cards":[{"id":"x"}]}`, string(m.Value), "a face-up deck's top is its first card")
+
+	drain(out)
+	g.HandleMessage(alice, Message{Type: "peek", Value: json.RawMessage(`{"deck":"nope"}`)})
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "unknown_deck", errorCode(t, m))
+	g.HandleMessage(alice, Message{Type: "peek", Value: json.RawMessage(`{"deck":"discard","count":11}`)})
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "invalid", errorCode(t, m))
+}
+
+func TestRevealShowsATrayCardUntilItEnds(t *testing.T) {
+	fake := clock.NewFake(time.Unix(0, 0))
+	g, out := NewGame(Config{Clock: fake})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RolePlayer)
+	mustConnect(t, g, "carol", RolePlayer)
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(`{"players":{"alice":{"tray":{"card:1":{"faceImageUrl":"ace.png"}}}}}`)})
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "reveal", Value: json.RawMessage(`{"card":"card:1","to":["bob"],"duration":3000}`)})
+	pm, m := nextOfType(t, out, "reveal")
+	require.Equal(t, []string{"bob"}, pm.To)
+	require.JSONEq(t, `{"player":"alice","id":"card:1","card":{"faceImageUrl":"ace.png"},"until":3000}`, string(m.Value))
+	_, m = nextOfType(t, out, "log")
+	require.Contains(t, string(m.Value), "alice showed a card to bob")
+	require.NotContains(t, string(m.Value), "ace.png")
+
+	fake.Advance(3 * time.Second)
+	pm, m = nextOfType(t, out, "revealEnd")
+	require.Equal(t, []string{"bob"}, pm.To)
+	require.JSONEq(t, `{"player":"alice","id":"card:1"}`, string(m.Value))
+
+	for _, bad := range []struct{ value, code string }{
+		{`{"card":"card:2","to":["bob"]}`, "unknown_card"},
+		{`{"card":"card:1","to":["dave"]}`, "unknown_player"},
+		{`{"card":"card:1","to":["alice"]}`, "invalid"},
+		{`{"card":"card:1","to":["bob"],"duration":600000}`, "invalid"},
+	} {
+		g.HandleMessage(alice, Message{Type: "reveal", Value: json.RawMessage(bad.value)})
+		_, m = nextOfType(t, out, "error")
+		require.Equal(t, bad.code, errorCode(t, m), bad.value)
+	}
+}
+
+func TestPeekIsForYourOwnDecksAndTheTables(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(
+		`{"decks":{"deck:alice:1":{"cards":[{"id":"a"}]},"deck:table:market":{"cards":[{"id":"m"}]}}}`)})
+	drain(out)
+
+	g.HandleMessage(bob, Message{Type: "peek", Value: json.RawMessage(`{"deck":"deck:alice:1"}`)})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "forbidden", errorCode(t, m))
+
+	g.HandleMessage(bob, Message{Type: "peek", Value: json.RawMessage(`{"deck":"deck:table:market"}`)})
+	pm, _ := nextOfType(t, out, "peek")
+	require.Equal(t, []string{"bob"}, pm.To)
+}
+
+func TestTrayCardsAreHiddenFromEveryoneElse(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(
+		`{"cards":{"c2":{"position":[0,0,0]}},"players":{"alice":{"tray":{"c1":{"faceImageUrl":"ace.png"}}}}}`)})
+	pm, m := nextOfType(t, out, "update")
+	require.Equal(t, []string{"bob"}, pm.To)
+	require.JSONEq(t, `{"cards":{"c2":{"position":[0,0,0]}},"players":{"alice":{"tray":{"c1":{}}}}}`, string(m.Value),
+		"bob can count alice's hand, not read it")
+
+	g.SyncPlayerState("bob")
+	_, m = nextOfType(t, out, "sync")
+	require.NotContains(t, string(m.Value), "ace.png")
+	g.SyncPlayerState("alice")
+	_, m = nextOfType(t, out, "sync")
+	require.Contains(t, string(m.Value), "ace.png", "alice still sees their own")
+
+	// an open seat's placeholder is no one's hand yet
+	g.HandleMessage(alice, Message{Type: "update", Value: json.RawMessage(`{"players":{"seat1":{"tray":{"c3":{"faceImageUrl":"king.png"}}}}}`)})
+	_, m = nextOfType(t, out, "update")
+	require.Contains(t, string(m.Value), "king.png")
+}
@@ -0,0 +1,210 @@
+package game
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// hostOnly are the message types only the lobby host may send.
+var hostOnly = map[string]bool{
+	"reset":   true,
+	"kick":    true,
+	"ban":     true,
+	"setRole": true,
+	// so is letting a locked-out player back in
+	"resetSecret": true,
+	// the turn order and the round are the host's; ending a turn is not
+	"setTurnOrder": true,
+	"setRound":     true,
+	// and so is the waiting room
+	"setCapacity": true,
+	"admit":       true,
+	// so are the clocks, except starting and stopping them (see clocks)
+	"setClocks":   true,
+	"pauseClock":  true,
+	"resumeClock": true,
+}
+
+// spectatorAllowed are the only message types a spectator may send — every
+// other type either mutates the table or shows the spectator to the lobby.
+// Chat is the exception: spectators may talk, not touch.
+var spectatorAllowed = map[string]bool{
+	"sync":    true,
+	"connect": true,
+	"chat":    true,
+}
+
+// forbidden returns why from may not send a message of type msgType, or ""
+// when it may.
+func (g *Game) forbidden(from *Player, msgType string) string {
+	g.mu.Lock()
+	role, removed := from.Role, from.removed
+	g.mu.Unlock()
+
+	if removed {
+		// a kicked host's sockets would otherwise be host until they close
+		return "you are no longer in this lobby"
+	}
+	if role == RoleSpectator && !spectatorAllowed[msgType] {
+		return "spectators cannot modify the table"
+	}
+	if hostOnly[msgType] && role != RoleHost {
+		return "only the host can " + msgType
+	}
+	return ""
+}
+
+// sendError tells a single player their message was rejected. The payload is
+// {"code", "type", "message"} where type is the rejected message's type.
+func (g *Game) sendError(to, msgType, code, reason string) {
+	value, _ := json.Marshal(map[string]string{
+		"code":    code,
+		"type":    msgType,
+		"message": reason,
+	})
+	payload, _ := json.Marshal(Message{
+		Type:      "error",
+		PlayerID:  to,
+		Timestamp: time.Now().UnixMilli(),
+		Value:     value,
+	})
+	g.send(&PlayerMessage{
+		To:      []string{to},
+		Content: payload,
+		Type:    "error",
+	})
+}
+
+// hostLocked returns the lobby's host, or nil. Caller must hold g.mu.
+func (g *Game) hostLocked() *Player {
+	for _, p := range g.Players {
+		if p.Role == RoleHost {
+			return p
+		}
+	}
+	return nil
+}
+
+// nextHostLocked picks who inherits the lobby when the host leaves: the
+// connected non-spectator who joined first. Caller must hold g.mu.
+func (g *Game) nextHostLocked() *Player {
+	var next *Player
+	for _, p := range g.Players {
+		if !p.Connected || p.Role != RolePlayer {
+			continue
+		}
+		if next == nil || p.JoinTimestamp < next.JoinTimestamp ||
+			(p.JoinTimestamp == next.JoinTimestamp && p.ID < next.ID) {
+			next = p
+		}
+	}
+	return next
+}
+
+// mergeRolesLocked writes the given players' server-owned rows (role, and the
+// joinTimestamp that comes and goes with it) into g.Data as a single patch
+// and returns the update message to broadcast. Caller must hold g.mu.
+func (g *Game) mergeRolesLocked(players ...*Player) []byte {
+	rows := make(map[string]any, len(players))
+	for _, p := range players {
+		rows[p.ID] = serverRowLocked(p)
+	}
+	return g.mergeServerPatchLocked(players[0].ID, map[string]any{"players": rows})
+}
+
+// targetValue is the payload of host actions aimed at another player.
+type targetValue struct {
+	Player string `json:"player"`
+	Role   Role   `json:"role,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// ban only: also refuse the player's source address
+	IP bool `json:"ip,omitempty"`
+}
+
+func decodeTarget(msg Message) (targetValue, bool) {
+	var v targetValue
+	if msg.Value == nil || json.Unmarshal(msg.Value, &v) != nil || v.Player == "" {
+		return v, false
+	}
+	return v, true
+}
+
+// reset is the host's reset message: wipe the table and re-sync everyone.
+func (g *Game) reset(from *Player) {
+	if err := g.resetTo(from.ID, nil); err != nil {
+		log.Err(err).Msg("Failed to reset the table")
+		return
+	}
+	log.Info().Str("player", from.ID).Msg("Host reset the table")
+}
+
+// setRole changes another player's role. Promoting someone to host hands the
+// lobby over: the old host becomes a player.
+func (g *Game) setRole(from *Player, msg Message) {
+	target, ok := decodeTarget(msg)
+	if !ok {
+		g.sendError(from.ID, msg.Type, "invalid", "setRole needs a player and a role")
+		return
+	}
+	switch target.Role {
+	case RoleHost, RolePlayer, RoleSpectator:
+	default:
+		g.sendError(from.ID, msg.Type, "invalid", "unknown role: "+string(target.Role))
+		return
+	}
+	if target.Player == from.ID {
+		g.sendError(from.ID, msg.Type, "invalid", "hand the lobby over by promoting another player")
+		return
+	}
+
+	g.mu.Lock()
+	p, exists := g.Players[target.Player]
+	if !exists {
+		g.mu.Unlock()
+		g.sendError(from.ID, msg.Type, "unknown_player", "no such player: "+target.Player)
+		return
+	}
+	p.Role = target.Role
+	changed := []*Player{p}
+	if target.Role == RoleHost {
+		from.Role = RolePlayer
+		changed = append(changed, from)
+	}
+	payload := g.mergeRolesLocked(changed...)
+	// spectators sit in the stands
+	var vacated []byte
+	if seat := p.Seat; target.Role == RoleSpectator && seat != NoSeat {
+		vacated = g.mergeServerPatchLocked(from.ID, map[string]any{
+			"players": map[string]any{p.ID: map[string]any{"seat": nil}},
+			"seats":   g.vacateSeatLocked(p),
+		})
+	}
+	g.LastActivity = time.Now()
+	logged := g.recordLocked(from.ID, logLine{"role", from.ID + " made " + p.ID + " " + roleNoun(target.Role)})
+	// promoting a waiter takes them out of the queue; demoting a player may
+	// make room for one
+	var waiting waitingChange
+	if wasWaiting := target.Role != RoleSpectator && g.unwaitLocked(p.ID); wasWaiting || len(g.waiting) > 0 {
+		waiting = g.fillLocked(from.ID)
+	}
+	g.mu.Unlock()
+
+	g.sendPresence(payload)
+	g.sendPresence(vacated)
+	g.sendLog(logged)
+	waiting.send(g)
+}
+
+// roleNoun phrases a role for the game log.
+func roleNoun(r Role) string {
+	switch r {
+	case RoleHost:
+		return "the host"
+	case RoleSpectator:
+		return "a spectator"
+	default:
+		return "a player"
+	}
+}
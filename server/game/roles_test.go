@@ -0,0 +1,233 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func errorCode(t *testing.T, m Message) string {
+	t.Helper()
+	var v map[string]string
+	require.NoError(t, json.Unmarshal(m.Value, &v))
+	return v["code"]
+}
+
+func TestFirstPlayerBecomesHost(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	require.Equal(t, RoleHost, alice.Role)
+	require.Equal(t, RolePlayer, bob.Role)
+
+	// the role rides the server-owned player row, so clients can render it
+	players := g.Data["players"].(map[string]any)
+	require.Equal(t, "host", players["alice"].(map[string]any)["role"])
+	require.Equal(t, "player", players["bob"].(map[string]any)["role"])
+}
+
+func TestSpectatorNeverBecomesHost(t *testing.T) {
+	g, out := NewGame(Config{})
+	watcher := mustConnect(t, g, "watcher", RoleSpectator)
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	drain(out)
+
+	require.Equal(t, RoleSpectator, watcher.Role)
+	require.Equal(t, RoleHost, alice.Role)
+}
+
+func TestSpectatorMutationsAreRejected(t *testing.T) {
+	g, out := NewGame(Config{})
+	mustConnect(t, g, "alice", RolePlayer)
+	watcher := mustConnect(t, g, "watcher", RoleSpectator)
+	drain(out)
+
+	g.mu.Lock()
+	before, _ := json.Marshal(g.Data)
+	g.mu.Unlock()
+
+	for _, typ := range []string{"update", "camera", "reset"} {
+		g.HandleMessage(watcher, Message{
+			Type:  typ,
+			Value: json.RawMessage(`{"decks":null}`),
+		})
+		pm, m := nextOfType(t, out, "error")
+		require.Equal(t, []string{"watcher"}, pm.To, "the rejection goes to the sender only")
+		require.Equal(t, "forbidden", errorCode(t, m))
+		require.Empty(t, out, "a rejected %s must not be relayed", typ)
+	}
+
+	g.mu.Lock()
+	after, _ := json.Marshal(g.Data)
+	g.mu.Unlock()
+	require.JSONEq(t, string(before), string(after))
+
+	// spectators still receive state
+	g.HandleMessage(watcher, Message{Type: "sync"})
+	pm, _ := nextOfType(t, out, "sync")
+	require.Equal(t, []string{"watcher"}, pm.To)
+}
+
+func TestHostOnlyMessagesRejectedForPlayers(t *testing.T) {
+	g, out := NewGame(Config{})
+	mustConnect(t, g, "alice", RolePlayer)
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	for _, typ := range []string{"reset", "kick", "setRole"} {
+		g.HandleMessage(bob, Message{Type: typ, Value: json.RawMessage(`{"player":"alice","role":"spectator"}`)})
+		_, m := nextOfType(t, out, "error")
+		require.Equal(t, "forbidden", errorCode(t, m), typ)
+	}
+	require.Equal(t, RoleHost, g.Players["alice"].Role)
+}
+
+func TestHostResetKeepsServerOwnedRows(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RolePlayer)
+	g.HandleMessage(alice, Message{
+		Type:  "update",
+		Value: json.RawMessage(`{"decks":{"d1":{"cards":[]}},"players":{"alice":{"tray":{"c1":{}}}}}`),
+	})
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "reset"})
+	pm, m := nextOfType(t, out, "sync")
+	other, _ := nextOfType(t, out, "sync")
+	require.ElementsMatch(t, []string{"alice", "bob"}, append(pm.To, other.To...), "a reset re-syncs the whole lobby")
+
+	var state map[string]any
+	require.NoError(t, json.Unmarshal(m.Value, &state))
+	require.NotContains(t, state, "decks")
+	players := state["players"].(map[string]any)
+	require.Len(t, players, 2)
+	row := players["alice"].(map[string]any)
+	require.NotContains(t, row, "tray", "client-written player data is wiped too")
+	require.Equal(t, true, row["connected"])
+	require.Equal(t, "host", row["role"])
+	require.Equal(t, "player", players["bob"].(map[string]any)["role"])
+}
+
+func TestHostKickClosesTargetSockets(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "kick", Value: json.RawMessage(`{"player":"bob"}`)})
+	select {
+	case pm := <-out:
+		require.Equal(t, []string{"bob"}, pm.To)
+		require.Equal(t, "kicked by host", pm.Close)
+	case <-time.After(time.Second):
+		t.Fatal("kick produced no close instruction")
+	}
+
+	g.HandleMessage(alice, Message{Type: "kick", Value: json.RawMessage(`{"player":"alice"}`)})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "invalid", errorCode(t, m))
+}
+
+func TestSetRoleHandsOverHost(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "setRole", Value: json.RawMessage(`{"player":"bob","role":"host"}`)})
+	_, m := nextOfType(t, out, "update")
+	var patch map[string]any
+	require.NoError(t, json.Unmarshal(m.Value, &patch))
+	require.Equal(t, "player", patch["players"].(map[string]any)["alice"].(map[string]any)["role"])
+	require.Equal(t, "host", patch["players"].(map[string]any)["bob"].(map[string]any)["role"])
+	require.Equal(t, RoleHost, bob.Role)
+	require.Equal(t, RolePlayer, alice.Role)
+
+	// alice is no longer host, so the next host action from alice is refused
+	g.HandleMessage(alice, Message{Type: "reset"})
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "forbidden", errorCode(t, m))
+}
+
+func TestHostLeavingPastGraceHandsOverHost(t *testing.T) {
+	g, out := NewGame(Config{})
+	g.offlineGrace = 20 * time.Millisecond
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	time.Sleep(2 * time.Millisecond) // distinct join timestamps
+	mustConnect(t, g, "bob", RolePlayer)
+	mustConnect(t, g, "watcher", RoleSpectator)
+	drain(out)
+
+	g.DisconnectPlayer(alice)
+	require.Eventually(t, func() bool {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return g.Players["bob"].Role == RoleHost
+	}, time.Second, 5*time.Millisecond)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	require.Equal(t, RolePlayer, g.Players["alice"].Role)
+	require.Equal(t, RoleSpectator, g.Players["watcher"].Role)
+}
+
+func TestReconnectNeedsTheSecret(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer) // host
+	drain(out)
+	g.Welcome("alice")
+	pm, m := nextOfType(t, out, "welcome")
+	require.Equal(t, []string{"alice"}, pm.To)
+	var v map[string]string
+	require.NoError(t, json.Unmarshal(m.Value, &v))
+	require.Equal(t, alice.secret, v["secret"])
+	require.NotEmpty(t, v["secret"])
+
+	// anyone can read the id off an update; it doesn't make them the host
+	g.DisconnectPlayer(alice)
+	for _, forged := range []string{"", "guess"} {
+		_, err := g.ConnectPlayer("alice", forged, RolePlayer)
+		require.ErrorIs(t, err, ErrWrongSecret)
+	}
+	p, err := g.ConnectPlayer("alice", v["secret"], RolePlayer)
+	require.NoError(t, err)
+	require.Equal(t, RoleHost, p.Role)
+
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	require.NotEqual(t, alice.secret, bob.secret, "every player gets their own")
+}
+
+func TestHostResetsALostSecret(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer) // host
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	lost := bob.secret
+	g.DisconnectPlayer(bob)
+	drain(out)
+
+	// bob's browser forgot the secret; only the host can let them back in
+	g.HandleMessage(bob, Message{Type: "resetSecret", Value: json.RawMessage(`{"player":"bob"}`)})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "forbidden", errorCode(t, m))
+	_, err := g.ConnectPlayer("bob", "", RolePlayer)
+	require.ErrorIs(t, err, ErrWrongSecret)
+
+	g.HandleMessage(alice, Message{Type: "resetSecret", Value: json.RawMessage(`{"player":"bob"}`)})
+	require.Contains(t, logTexts(g), "alice let bob rejoin with a new secret")
+	p, err := g.ConnectPlayer("bob", "", RolePlayer)
+	require.NoError(t, err)
+	require.Same(t, bob, p, "bob keeps their row, role and seat")
+	require.NotEmpty(t, p.secret)
+	require.NotEqual(t, lost, p.secret)
+
+	// and the new secret holds from then on
+	g.DisconnectPlayer(bob)
+	_, err = g.ConnectPlayer("bob", "", RolePlayer)
+	require.ErrorIs(t, err, ErrWrongSecret)
+	drain(out)
+}
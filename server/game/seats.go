@@ -0,0 +1,255 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// NoSeat is Player.Seat for a player who holds no seat.
+const NoSeat = -1
+
+// seatClaim asks for player to sit in seat, or to stand up with NoSeat.
+type seatClaim struct {
+	player string
+	seat   int
+}
+
+// seatValue is the payload of claimSeat and releaseSeat. Player defaults to
+// the sender; only the host may name someone else.
+type seatValue struct {
+	Seat   *int   `json:"seat,omitempty"`
+	Player string `json:"player,omitempty"`
+}
+
+// seatsValue is the initial g.Data["seats"]: how many seats the table has and
+// who sits where, keyed by seat number. The server keeps it and every
+// players[id].seat in step; clients never write either for a player.
+func seatsValue(count int) map[string]any {
+	return map[string]any{"count": float64(count), "taken": map[string]any{}}
+}
+
+// seatPatchLocked arbitrates claims, in order, against the seats as they
+// stand: first come wins, and a taken seat is refused unless override — the
+// host's privilege — in which case its holder is stood up. A player moving
+// seats gives up the old one.
+//
+// It returns the patch that applies the claims to g.Data and a commit func
+// that applies them to the players, to be called once the patch is merged.
+// A refused claim leaves its player where they sat, which the patch says
+// again for whoever moved them early; refused is why, and the other claims
+// still apply. Caller must hold g.mu.
+func (g *Game) seatPatchLocked(claims []seatClaim, override bool) (patch map[string]any, commit func(), refused, rej *rejection) {
+	seatOf := make(map[string]int, len(g.Players))
+	holder := make(map[int]string, g.seatCount)
+	for id, p := range g.Players {
+		seatOf[id] = p.Seat
+		if p.Seat != NoSeat {
+			holder[p.Seat] = id
+		}
+	}
+
+	rows := map[string]any{}
+	taken := map[string]any{}
+	for _, c := range claims {
+		old := seatOf[c.player]
+		if c.seat == old {
+			rows[c.player] = map[string]any{"seat": seatJSON(c.seat)}
+			continue
+		}
+		if c.seat != NoSeat {
+			if c.seat < 0 || c.seat >= g.seatCount {
+				return nil, nil, nil, &rejection{"invalid", fmt.Errorf("no such seat: %d (the table has %d)", c.seat, g.seatCount)}
+			}
+			if g.Players[c.player].Role == RoleSpectator {
+				return nil, nil, nil, &rejection{"invalid", errors.New("spectators cannot take a seat")}
+			}
+			if h, ok := holder[c.seat]; ok {
+				if !override {
+					if refused == nil {
+						refused = &rejection{"seat_taken", fmt.Errorf("seat %d is taken by %s", c.seat, h)}
+					}
+					rows[c.player] = map[string]any{"seat": seatJSON(old)}
+					continue
+				}
+				seatOf[h] = NoSeat
+				rows[h] = map[string]any{"seat": nil}
+			}
+			holder[c.seat] = c.player
+			taken[strconv.Itoa(c.seat)] = c.player
+		}
+		if old != NoSeat {
+			delete(holder, old)
+			if _, reseated := taken[strconv.Itoa(old)]; !reseated {
+				taken[strconv.Itoa(old)] = nil
+			}
+		}
+		seatOf[c.player] = c.seat
+		rows[c.player] = map[string]any{"seat": seatJSON(c.seat)}
+	}
+
+	commit = func() {
+		for id := range rows {
+			if p, ok := g.Players[id]; ok {
+				p.Seat = seatOf[id]
+			}
+		}
+	}
+	patch = map[string]any{"players": rows}
+	if len(taken) > 0 {
+		patch["seats"] = map[string]any{"taken": taken}
+	}
+	return patch, commit, refused, nil
+}
+
+// mergeSeatPatch folds a seatPatchLocked patch into a client patch. Unlike
+// jsonmerge.MergeMaps it keeps the nulls, which are the point.
+func mergeSeatPatch(patch, seats map[string]any) {
+	rows, _ := patch["players"].(map[string]any)
+	if rows == nil {
+		rows = map[string]any{}
+		patch["players"] = rows
+	}
+	for id, fields := range seats["players"].(map[string]any) {
+		row, _ := rows[id].(map[string]any)
+		if row == nil {
+			row = map[string]any{}
+			rows[id] = row
+		}
+		row["seat"] = fields.(map[string]any)["seat"]
+	}
+	if taken, ok := seats["seats"]; ok {
+		patch["seats"] = taken
+	}
+}
+
+// seatJSON is a seat as it sits in a players row.
+func seatJSON(seat int) any {
+	if seat == NoSeat {
+		return nil
+	}
+	return float64(seat)
+}
+
+// seatClaimsLocked turns the seat fields of a client patch into claims, so a
+// client that still picks its seat by writing players[id].seat is arbitrated
+// like claimSeat. Rows of ids that are not players — a scenario's seat
+// placeholders — are table state and left alone. The claims' seat fields are
+// removed from patch; seatPatchLocked writes them back. Caller must hold g.mu.
+func (g *Game) seatClaimsLocked(patch map[string]any) ([]seatClaim, *rejection) {
+	rows, _ := patch["players"].(map[string]any)
+	var claims []seatClaim
+	for _, id := range sortedKeys(rows) {
+		if _, player := g.Players[id]; !player {
+			continue
+		}
+		row, _ := rows[id].(map[string]any)
+		v, ok := row["seat"]
+		if !ok {
+			continue
+		}
+		c := seatClaim{player: id, seat: NoSeat}
+		if v != nil {
+			n, isNum := v.(float64)
+			if !isNum || n != float64(int(n)) {
+				return nil, &rejection{"invalid", fmt.Errorf("seat must be a whole number: %v", v)}
+			}
+			c.seat = int(n)
+		}
+		claims = append(claims, c)
+		delete(row, "seat")
+		if len(row) == 0 {
+			delete(rows, id)
+		}
+	}
+	if len(rows) == 0 {
+		delete(patch, "players")
+	}
+	return claims, nil
+}
+
+// seats handles claimSeat and releaseSeat.
+func (g *Game) seats(from *Player, msg Message) {
+	var v seatValue
+	if msg.Value != nil && json.Unmarshal(msg.Value, &v) != nil {
+		g.sendError(from.ID, msg.Type, "invalid", "malformed "+msg.Type)
+		return
+	}
+	if msg.Type == "claimSeat" && v.Seat == nil {
+		g.sendError(from.ID, msg.Type, "invalid", "claimSeat needs a seat")
+		return
+	}
+
+	g.mu.Lock()
+	id := from.ID
+	if v.Player != "" && v.Player != from.ID {
+		if from.Role != RoleHost {
+			g.mu.Unlock()
+			g.sendError(from.ID, msg.Type, "forbidden", "only the host can seat another player")
+			return
+		}
+		id = v.Player
+	}
+	if _, ok := g.Players[id]; !ok {
+		g.mu.Unlock()
+		g.sendError(from.ID, msg.Type, "unknown_player", "no such player: "+id)
+		return
+	}
+	claim := seatClaim{player: id, seat: NoSeat}
+	if msg.Type == "claimSeat" {
+		claim.seat = *v.Seat
+	}
+	patch, commit, refused, err := g.seatPatchLocked([]seatClaim{claim}, from.Role == RoleHost)
+	if err == nil {
+		err = refused
+	}
+	if err != nil {
+		g.mu.Unlock()
+		g.sendError(from.ID, msg.Type, err.code, err.Error())
+		return
+	}
+	payload := g.mergeServerPatchLocked(from.ID, patch)
+	commit()
+	line := logLine{"seat", fmt.Sprintf("%s took seat %d", id, claim.seat)}
+	if claim.seat == NoSeat {
+		line.text = id + " left their seat"
+	}
+	if id != from.ID {
+		line.text += " (by " + from.ID + ")"
+	}
+	logged := g.recordLocked(from.ID, line)
+	g.LastActivity = time.Now()
+	g.mu.Unlock()
+
+	g.sendPresence(payload)
+	g.sendLog(logged)
+}
+
+// seatCorrectionLocked is the update that puts p back in the seat they hold,
+// for a client whose own patch already sat them where a refused claim would
+// have — the relay of that patch skips its sender. Caller must hold g.mu.
+func (g *Game) seatCorrectionLocked(p *Player) *PlayerMessage {
+	value, _ := json.Marshal(map[string]any{
+		"players": map[string]any{p.ID: map[string]any{"seat": seatJSON(p.Seat)}},
+	})
+	payload, _ := json.Marshal(Message{
+		Type:      "update",
+		Timestamp: time.Now().UnixMilli(),
+		Value:     value,
+	})
+	return &PlayerMessage{To: []string{p.ID}, Content: payload, Type: "update"}
+}
+
+// vacateSeatLocked returns the patch fragment that frees p's seat, or nil
+// when p holds none, and stands p up. For players leaving the table for good
+// — kicked, or moved to the spectators. Caller must hold g.mu.
+func (g *Game) vacateSeatLocked(p *Player) map[string]any {
+	if p.Seat == NoSeat {
+		return nil
+	}
+	taken := map[string]any{strconv.Itoa(p.Seat): nil}
+	p.Seat = NoSeat
+	return map[string]any{"taken": taken}
+}
@@ -0,0 +1,83 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func seatsTaken(t *testing.T, g *Game) map[string]any {
+	t.Helper()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.Data["seats"].(map[string]any)["taken"].(map[string]any)
+}
+
+func TestFirstClaimWinsASeat(t *testing.T) {
+	g, out := NewGame(Config{Seats: 6})
+	alice := mustConnect(t, g, "alice", RolePlayer) // host
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	carol := mustConnect(t, g, "carol", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(bob, Message{Type: "claimSeat", Value: json.RawMessage(`{"seat":5}`)})
+	g.HandleMessage(carol, Message{Type: "claimSeat", Value: json.RawMessage(`{"seat":5}`)})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "seat_taken", errorCode(t, m))
+	require.Equal(t, map[string]any{"5": "bob"}, seatsTaken(t, g))
+	require.Equal(t, float64(5), playerRow(t, g, "bob")["seat"])
+
+	// the old way of sitting down — writing your own row — is arbitrated
+	// too: the seat is refused, and carol told where they still sit, but the
+	// rest of their update goes through
+	g.HandleMessage(carol, Message{Type: "update", Value: json.RawMessage(`{"players":{"carol":{"seat":5,"tray":{"x":1}}}}`)})
+	pm, m := nextOfType(t, out, "update")
+	require.Equal(t, []string{"carol"}, pm.To)
+	require.JSONEq(t, `{"players":{"carol":{"seat":null}}}`, string(m.Value))
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "seat_taken", errorCode(t, m))
+	require.Equal(t, map[string]any{"x": float64(1)}, playerRow(t, g, "carol")["tray"])
+	require.NotContains(t, playerRow(t, g, "carol"), "seat")
+	g.HandleMessage(carol, Message{Type: "update", Value: json.RawMessage(`{"players":{"carol":{"seat":2}}}`)})
+	require.Equal(t, map[string]any{"5": "bob", "2": "carol"}, seatsTaken(t, g))
+
+	g.HandleMessage(carol, Message{Type: "claimSeat", Value: json.RawMessage(`{"seat":6}`)})
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "invalid", errorCode(t, m), "seats are numbered from 0")
+
+	// the host overrides: bob is stood up
+	g.HandleMessage(alice, Message{Type: "claimSeat", Value: json.RawMessage(`{"seat":5}`)})
+	require.Equal(t, map[string]any{"5": "alice", "2": "carol"}, seatsTaken(t, g))
+	require.NotContains(t, playerRow(t, g, "bob"), "seat")
+	g.mu.Lock()
+	require.Equal(t, NoSeat, bob.Seat)
+	g.mu.Unlock()
+}
+
+func TestReleasedAndVacatedSeatsOpenUp(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	carol := mustConnect(t, g, "carol", RolePlayer)
+	g.HandleMessage(bob, Message{Type: "claimSeat", Value: json.RawMessage(`{"seat":1}`)})
+	g.HandleMessage(carol, Message{Type: "claimSeat", Value: json.RawMessage(`{"seat":2}`)})
+	g.HandleMessage(alice, Message{Type: "claimSeat", Value: json.RawMessage(`{"seat":3,"player":"alice"}`)})
+	drain(out)
+
+	g.HandleMessage(bob, Message{Type: "releaseSeat"})
+	g.HandleMessage(bob, Message{Type: "releaseSeat", Value: json.RawMessage(`{"player":"carol"}`)})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "forbidden", errorCode(t, m))
+	require.Equal(t, map[string]any{"2": "carol", "3": "alice"}, seatsTaken(t, g))
+
+	g.HandleMessage(alice, Message{Type: "setRole", Value: json.RawMessage(`{"player":"carol","role":"spectator"}`)})
+	require.NoError(t, g.Kick("alice", KickOptions{}))
+	require.Empty(t, seatsTaken(t, g))
+	drain(out)
+
+	// the seat map rides along in every sync
+	g.SyncPlayerState("bob")
+	_, m = nextOfType(t, out, "sync")
+	require.Contains(t, string(m.Value), `"seats":{"count":4`)
+}
@@ -0,0 +1,78 @@
+package game
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrWrongSecret is returned by ConnectPlayer when a known player id is
+// claimed without the secret it was issued. A player id is public — it keys
+// their row in every update — so the first socket to join as an id is issued
+// a secret, and every later socket for that id must present it before it gets
+// the player's role and seat back. A player who lost theirs asks the host for
+// a resetSecret.
+var ErrWrongSecret = errors.New("wrong secret for this player id")
+
+// secretMatches reports whether secret is p's, in constant time.
+func secretMatches(p *Player, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(p.secret), []byte(secret)) == 1
+}
+
+// Welcome sends player id their secret, to be presented when they reconnect:
+// {"secret"}, to them alone.
+func (g *Game) Welcome(id string) {
+	g.mu.Lock()
+	p, ok := g.Players[id]
+	var secret string
+	if ok {
+		secret = p.secret
+	}
+	g.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	value, _ := json.Marshal(map[string]string{"secret": secret})
+	payload, _ := json.Marshal(Message{
+		Type:      "welcome",
+		PlayerID:  id,
+		Timestamp: time.Now().UnixMilli(),
+		Value:     value,
+	})
+	g.send(&PlayerMessage{To: []string{id}, Content: payload, Type: "welcome"})
+}
+
+// resetSecret handles resetSecret, {"player"}: the host forgets a player's
+// secret, for one locked out of their id — a cleared browser, a new device.
+// The next socket to join as that id is issued a new one.
+func (g *Game) resetSecret(from *Player, msg Message) {
+	var v struct {
+		Player string `json:"player"`
+	}
+	if msg.Value == nil || json.Unmarshal(msg.Value, &v) != nil || v.Player == "" {
+		g.sendError(from.ID, msg.Type, "invalid", "resetSecret needs a player")
+		return
+	}
+
+	g.mu.Lock()
+	p, ok := g.Players[v.Player]
+	if !ok {
+		g.mu.Unlock()
+		g.sendError(from.ID, msg.Type, "unknown_player", "no such player: "+v.Player)
+		return
+	}
+	p.secret = ""
+	logged := g.recordLocked(from.ID, logLine{"join", fmt.Sprintf("%s let %s rejoin with a new secret", from.ID, v.Player)})
+	g.mu.Unlock()
+
+	g.sendLog(logged)
+}
+
+// newSecret issues a secret for a first join.
+func newSecret() string {
+	return rand.Text()
+}
@@ -2,8 +2,12 @@ package game
 
 import (
 	"encoding/json"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/jollygrin/tts-server/clock"
 )
 
 type Game struct {
@@ -18,58 +22,214 @@ type Game struct {
 
 	out chan *PlayerMessage
 	mu  sync.Mutex
+	// closed by Close; blocked sends on out give up
+	done      chan struct{}
+	closeOnce sync.Once
 
 	// pending offline broadcasts, keyed by player id — armed on disconnect,
 	// cancelled when the same id reconnects inside the grace period
 	offlineTimers map[string]*time.Timer
 	offlineGrace  time.Duration
+
+	// player ids refused on connect for the rest of the game, with the reason
+	banned map[string]string
+
+	events *Events
+
+	// lobby chat, oldest first, at most chatHistory lines (see chat)
+	chatLog     []ChatMessage
+	chatSeq     int64
+	chatHistory int
+	chatLength  int
+	// game log, oldest first, at most logHistory entries (see describePatch)
+	gameLog    []LogEntry
+	logSeq     int64
+	logHistory int
+	// turn order, nil until the host sets one (see turn)
+	turnState *turnState
+	// game clocks, nil until the host sets them (see clocks)
+	clockState *clockState
+	clock      clock.Clock
+	clockTick  time.Duration
+	seatCount  int
+	// waiting room: at most capacity players, 0 for no limit, and the
+	// spectators queued for a place (see fillLocked)
+	capacity int
+	waiting  []string
+
+	// what is in each bag, by the bag's piece id; g.Data only has the
+	// counts (see bagContents)
+	pools map[string][]any
+	// what each pool encodes to, which counts towards Limits.MaxStateBytes
+	poolBytes map[string]int
+
+	// throws one die for rollExpr and random bag draws; tests load the dice
+	dice func(sides int) int
+	// set when a broadcast had to be dropped; see TakeDropped
+	dropped atomic.Bool
+
+	limits Limits
+	// upper bound on the encoded size of Data (see stateFitsLocked)
+	stateBytes int
+	// quota rejections, for admin views
+	rejectedPlayers int64
+	rejectedUpdates int64
 }
 
-// offlineGraceDefault is how long a disconnected player has to reconnect
-// before the lobby is told they went offline. Covers page refreshes and brief
-// network blips without the other clients ever seeing a flicker.
-const offlineGraceDefault = 5 * time.Second
+// Config tunes a game. Zero fields take their DefaultConfig value, except
+// Limits, where zero means unlimited.
+type Config struct {
+	Limits Limits
+	// OfflineGrace is how long a disconnected player has to reconnect before
+	// the lobby is told they went offline. Covers page refreshes and brief
+	// network blips without the other clients ever seeing a flicker.
+	OfflineGrace time.Duration
+	// OutBuffer is the capacity of the channel NewGame returns.
+	OutBuffer int
+	// ChatHistory is how many chat lines the lobby keeps to replay to
+	// joiners; ChatLength caps one line, in characters.
+	ChatHistory int
+	ChatLength  int
+	// LogHistory is how many game log entries the lobby keeps.
+	LogHistory int
+	// Seats is how many seats the table has.
+	Seats int
+	// Capacity is how many players the table takes before joiners wait as
+	// spectators for a place; 0 means no limit. The host can change it.
+	Capacity int
+	// Clock runs the game clocks; tests swap in a clock.Fake. ClockTick is
+	// how often a running game clock is re-broadcast.
+	Clock     clock.Clock
+	ClockTick time.Duration
+}
+
+// DefaultConfig is what a game gets when nothing is configured.
+var DefaultConfig = Config{
+	OfflineGrace: 5 * time.Second,
+	OutBuffer:    50,
+	ChatHistory:  100,
+	ChatLength:   500,
+	LogHistory:   500,
+	Seats:        4,
+	Clock:        clock.Real{},
+	ClockTick:    time.Second,
+}
 
 type PlayerMessage struct {
 	// TODO: Probably a better way to add addressing
 	To      []string // If To is empty, it sends to all
 	Exclude string   // Easy method to exclude a player
 	Content json.RawMessage
+	// Type is Content's message type, so the lobby can count deliveries
+	// without decoding them
+	Type string
+	// Close, when set, tells the lobby to close the addressed players' sockets
+	// with this reason instead of delivering Content (kicks and bans)
+	Close string
+	// BanIP, with Close, also has the lobby refuse the addressed players'
+	// source addresses — those of their sockets, or the last they connected
+	// from when they're offline — for the rest of its lifetime
+	BanIP bool
 }
 
-func NewGame() (*Game, <-chan *PlayerMessage) {
-	out := make(chan *PlayerMessage, 50)
+func NewGame(cfg Config) (*Game, <-chan *PlayerMessage) {
+	if cfg.OfflineGrace == 0 {
+		cfg.OfflineGrace = DefaultConfig.OfflineGrace
+	}
+	if cfg.OutBuffer == 0 {
+		cfg.OutBuffer = DefaultConfig.OutBuffer
+	}
+	if cfg.ChatHistory == 0 {
+		cfg.ChatHistory = DefaultConfig.ChatHistory
+	}
+	if cfg.ChatLength == 0 {
+		cfg.ChatLength = DefaultConfig.ChatLength
+	}
+	if cfg.LogHistory == 0 {
+		cfg.LogHistory = DefaultConfig.LogHistory
+	}
+	if cfg.Seats == 0 {
+		cfg.Seats = DefaultConfig.Seats
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = DefaultConfig.Clock
+	}
+	if cfg.ClockTick == 0 {
+		cfg.ClockTick = DefaultConfig.ClockTick
+	}
+	out := make(chan *PlayerMessage, cfg.OutBuffer)
 	now := time.Now()
-	return &Game{
+	g := &Game{
+		limits:        cfg.Limits,
 		Players:       make(map[string]*Player),
 		out:           out,
-		Data:          map[string]any{},
+		done:          make(chan struct{}),
+		Data:          map[string]any{"seats": seatsValue(cfg.Seats)},
 		CreatedAt:     now,
 		LastActivity:  now,
 		offlineTimers: make(map[string]*time.Timer),
-		offlineGrace:  offlineGraceDefault,
-	}, out
+		offlineGrace:  cfg.OfflineGrace,
+		chatHistory:   cfg.ChatHistory,
+		chatLength:    cfg.ChatLength,
+		logHistory:    cfg.LogHistory,
+		clock:         cfg.Clock,
+		clockTick:     cfg.ClockTick,
+		seatCount:     cfg.Seats,
+		capacity:      cfg.Capacity,
+		pools:         make(map[string][]any),
+		poolBytes:     make(map[string]int),
+		dice:          rollFace,
+		banned:        make(map[string]string),
+		events:        newEvents(),
+	}
+	if g.capacity > 0 {
+		g.Data["lobby"] = g.lobbyValueLocked()
+	}
+	return g, out
 }
 
+// Role decides which messages a player may send.
+type Role string
+
+const (
+	// RoleHost may do everything a player can, plus the host-only messages
+	// (reset, kick, setRole). A lobby has at most one host.
+	RoleHost Role = "host"
+	// RolePlayer may mutate the table and their own seat.
+	RolePlayer Role = "player"
+	// RoleSpectator receives state but every mutating message is rejected.
+	RoleSpectator Role = "spectator"
+)
+
 // Player represents a player in the game
 // TODO: This player
 type Player struct {
 	ID            string `json:"id"`
 	JoinTimestamp int64  `json:"joinTimestamp"`
 	Connected     bool   `json:"connected"`
-	Seat          int    `json:"seat,omitempty"`
+	Role          Role   `json:"role"`
+	// Seat is the seat this player holds, NoSeat until they claim one (see
+	// seatPatchLocked). Holding it owns the seat's placeholder row, if the
+	// scenario has one (see rowOwnerLocked).
+	Seat int `json:"seat"`
 
 	// live socket count for this player id — a reconnect can attach the new
 	// socket before the old one's close is noticed, and the player is only
 	// offline when the last socket is gone
 	conns int
+	// issued on the first join and asked for on every reconnect; see Welcome
+	secret string
+	// set when the player is kicked: the detached Player's sockets are being
+	// closed and may send nothing more (see forbidden)
+	removed bool
 }
 
 // PlayerStat is a lock-free copy of a player's status for admin views.
 type PlayerStat struct {
-	ID            string
-	JoinTimestamp int64
-	Connected     bool
+	ID            string `json:"id"`
+	JoinTimestamp int64  `json:"joinTimestamp"`
+	Connected     bool   `json:"connected"`
+	Role          Role   `json:"role"`
 }
 
 // Stats is a snapshot of the game for admin views.
@@ -79,6 +239,12 @@ type Stats struct {
 	Updates      int64
 	CreatedAt    time.Time
 	LastActivity time.Time
+	// joins refused by Limits.MaxPlayers
+	RejectedPlayers int64
+	// updates refused by Limits.MaxStateBytes
+	RejectedUpdates int64
+	// banned player ids
+	Banned []string
 }
 
 func (g *Game) Stats() Stats {
@@ -90,12 +256,20 @@ func (g *Game) Stats() Stats {
 		Updates:      g.Updates,
 		CreatedAt:    g.CreatedAt,
 		LastActivity: g.LastActivity,
+
+		RejectedPlayers: g.rejectedPlayers,
+		RejectedUpdates: g.rejectedUpdates,
+	}
+	for id := range g.banned {
+		s.Banned = append(s.Banned, id)
 	}
+	sort.Strings(s.Banned)
 	for _, p := range g.Players {
 		s.Players = append(s.Players, PlayerStat{
 			ID:            p.ID,
 			JoinTimestamp: p.JoinTimestamp,
 			Connected:     p.Connected,
+			Role:          p.Role,
 		})
 	}
 	return s
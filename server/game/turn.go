@@ -0,0 +1,195 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+// turnState is the lobby's turn order, mirrored into g.Data["turn"] so every
+// client renders whose turn it is from ordinary state. Clients never write
+// it; every change goes through the turn messages below.
+type turnState struct {
+	Order   []string
+	Current string
+	Round   int
+}
+
+// value is ts as it sits in g.Data — decoded-JSON types, like everything
+// merged from a client.
+func (ts *turnState) value() map[string]any {
+	order := make([]any, len(ts.Order))
+	for i, id := range ts.Order {
+		order[i] = id
+	}
+	return map[string]any{
+		"order":   order,
+		"current": ts.Current,
+		"round":   float64(ts.Round),
+	}
+}
+
+// turnValue is the payload of the turn messages; each reads only its fields.
+type turnValue struct {
+	// setTurnOrder: an explicit order of player ids, or BySeat to order the
+	// seated players by seat and then by join order
+	Order  []string `json:"order,omitempty"`
+	BySeat bool     `json:"bySeat,omitempty"`
+	// passTurn: who to hand the turn to; without one, passing skips ahead
+	// like endTurn
+	Player string `json:"player,omitempty"`
+	// setRound
+	Round int `json:"round,omitempty"`
+}
+
+// turn handles setTurnOrder, endTurn, passTurn and setRound. Setting the
+// order and the round is the host's; advancing is the current player's or
+// the host's. Each change is applied under g.mu, so two players ending the
+// same turn at once advance it once.
+func (g *Game) turn(from *Player, msg Message) {
+	var v turnValue
+	if msg.Value != nil && json.Unmarshal(msg.Value, &v) != nil {
+		g.sendError(from.ID, msg.Type, "invalid", "malformed "+msg.Type)
+		return
+	}
+
+	g.mu.Lock()
+	var (
+		line logLine
+		err  *rejection
+	)
+	switch msg.Type {
+	case "setTurnOrder":
+		line, err = g.setTurnOrderLocked(from, v)
+	case "endTurn", "passTurn":
+		line, err = g.advanceTurnLocked(from, msg.Type, v.Player)
+	case "setRound":
+		line, err = g.setRoundLocked(from, v.Round)
+	}
+	if err != nil {
+		g.mu.Unlock()
+		g.sendError(from.ID, msg.Type, err.code, err.Error())
+		return
+	}
+	payload := g.mergeServerPatchLocked(from.ID, map[string]any{"turn": g.turnState.value()})
+	// a running game clock follows the turn
+	var clocks []byte
+	if now := g.clock.Now(); g.handClockLocked(g.turnState.Current, now) {
+		clocks = g.clockChangedLocked(from.ID, now)
+	}
+	logged := g.recordLocked(from.ID, line)
+	g.LastActivity = time.Now()
+	g.mu.Unlock()
+
+	g.sendPresence(payload)
+	g.sendPresence(clocks)
+	g.sendLog(logged)
+}
+
+func (g *Game) setTurnOrderLocked(from *Player, v turnValue) (logLine, *rejection) {
+	order := v.Order
+	if v.BySeat {
+		order = g.seatOrderLocked()
+	}
+	if len(order) == 0 {
+		return logLine{}, &rejection{"invalid", errors.New("setTurnOrder needs an order or bySeat")}
+	}
+	seen := make(map[string]bool, len(order))
+	for _, id := range order {
+		p, ok := g.Players[id]
+		if !ok {
+			return logLine{}, &rejection{"unknown_player", fmt.Errorf("no such player: %s", id)}
+		}
+		if p.Role == RoleSpectator {
+			return logLine{}, &rejection{"invalid", fmt.Errorf("spectators take no turns: %s", id)}
+		}
+		if seen[id] {
+			return logLine{}, &rejection{"invalid", fmt.Errorf("%s is in the order twice", id)}
+		}
+		seen[id] = true
+	}
+	g.turnState = &turnState{Order: slices.Clone(order), Current: order[0], Round: 1}
+	return logLine{"turn", fmt.Sprintf("%s set the turn order — round 1, %s is up", from.ID, order[0])}, nil
+}
+
+// seatOrderLocked is every non-spectator ordered by seat, then by join order;
+// players without a seat come last. Caller must hold g.mu.
+func (g *Game) seatOrderLocked() []string {
+	var seated []*Player
+	for _, p := range g.Players {
+		if p.Role != RoleSpectator {
+			seated = append(seated, p)
+		}
+	}
+	sort.Slice(seated, func(i, j int) bool {
+		if a, b := seated[i].Seat, seated[j].Seat; a != b {
+			if a == NoSeat || b == NoSeat {
+				return b == NoSeat
+			}
+			return a < b
+		}
+		if seated[i].JoinTimestamp != seated[j].JoinTimestamp {
+			return seated[i].JoinTimestamp < seated[j].JoinTimestamp
+		}
+		return seated[i].ID < seated[j].ID
+	})
+	order := make([]string, len(seated))
+	for i, p := range seated {
+		order[i] = p.ID
+	}
+	return order
+}
+
+// advanceTurnLocked ends the current turn. With a player (passTurn only) the
+// turn goes straight to them and the round stands; otherwise it goes to the
+// next player in the order still in the lobby, and wrapping around starts a
+// new round. Caller must hold g.mu.
+func (g *Game) advanceTurnLocked(from *Player, msgType, to string) (logLine, *rejection) {
+	ts := g.turnState
+	if ts == nil {
+		return logLine{}, &rejection{"no_turn", errors.New("no turn order is set")}
+	}
+	if from.ID != ts.Current && from.Role != RoleHost {
+		return logLine{}, &rejection{"forbidden", fmt.Errorf("it is %s's turn", ts.Current)}
+	}
+	verb := "ended their turn"
+	if msgType == "passTurn" {
+		verb = "passed"
+	}
+
+	if to != "" && msgType == "passTurn" {
+		if !slices.Contains(ts.Order, to) {
+			return logLine{}, &rejection{"unknown_player", fmt.Errorf("not in the turn order: %s", to)}
+		}
+		ts.Current = to
+		return logLine{"turn", fmt.Sprintf("%s %s — %s is up", from.ID, verb, to)}, nil
+	}
+
+	i, round := slices.Index(ts.Order, ts.Current), ts.Round
+	for range ts.Order {
+		i++
+		if i >= len(ts.Order) {
+			i = 0
+			round++
+		}
+		if _, ok := g.Players[ts.Order[i]]; ok {
+			ts.Current, ts.Round = ts.Order[i], round
+			return logLine{"turn", fmt.Sprintf("%s %s — round %d, %s is up", from.ID, verb, ts.Round, ts.Current)}, nil
+		}
+	}
+	return logLine{}, &rejection{"no_turn", errors.New("nobody in the turn order is left")}
+}
+
+func (g *Game) setRoundLocked(from *Player, round int) (logLine, *rejection) {
+	if g.turnState == nil {
+		return logLine{}, &rejection{"no_turn", errors.New("no turn order is set")}
+	}
+	if round < 1 {
+		return logLine{}, &rejection{"invalid", errors.New("setRound needs a round of at least 1")}
+	}
+	g.turnState.Round = round
+	return logLine{"turn", fmt.Sprintf("%s set the round to %d", from.ID, round)}, nil
+}
@@ -0,0 +1,83 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func turnRow(t *testing.T, g *Game) map[string]any {
+	t.Helper()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	turn, _ := g.Data["turn"].(map[string]any)
+	return turn
+}
+
+func TestTurnsAdvanceAndWrapIntoTheNextRound(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer) // host
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(alice, Message{Type: "setTurnOrder", Value: json.RawMessage(`{"order":["bob","alice"]}`)})
+	_, m := nextOfType(t, out, "update")
+	require.JSONEq(t, `{"turn":{"order":["bob","alice"],"current":"bob","round":1}}`, string(m.Value))
+
+	g.HandleMessage(bob, Message{Type: "endTurn"})
+	require.Equal(t, "alice", turnRow(t, g)["current"])
+	g.HandleMessage(alice, Message{Type: "endTurn"})
+	require.Equal(t, "bob", turnRow(t, g)["current"])
+	require.Equal(t, float64(2), turnRow(t, g)["round"])
+
+	g.HandleMessage(bob, Message{Type: "passTurn", Value: json.RawMessage(`{"player":"alice"}`)})
+	require.Equal(t, "alice", turnRow(t, g)["current"])
+	require.Equal(t, float64(2), turnRow(t, g)["round"], "handing the turn over is not a new round")
+
+	g.HandleMessage(alice, Message{Type: "setRound", Value: json.RawMessage(`{"round":7}`)})
+	require.Equal(t, float64(7), turnRow(t, g)["round"])
+}
+
+func TestOnlyTheCurrentPlayerOrHostAdvances(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	carol := mustConnect(t, g, "carol", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(bob, Message{Type: "endTurn"})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "no_turn", errorCode(t, m))
+
+	g.HandleMessage(alice, Message{Type: "setTurnOrder", Value: json.RawMessage(`{"bySeat":true}`)})
+	require.Equal(t, []any{"alice", "bob", "carol"}, turnRow(t, g)["order"], "seats tie, so join order decides")
+	drain(out)
+
+	g.HandleMessage(carol, Message{Type: "endTurn"})
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "forbidden", errorCode(t, m))
+	g.HandleMessage(bob, Message{Type: "setRound", Value: json.RawMessage(`{"round":3}`)})
+	_, m = nextOfType(t, out, "error")
+	require.Equal(t, "forbidden", errorCode(t, m))
+
+	g.HandleMessage(alice, Message{Type: "endTurn"}) // the host's own turn
+	g.HandleMessage(alice, Message{Type: "endTurn"}) // bob's, as host
+	require.Equal(t, "carol", turnRow(t, g)["current"])
+}
+
+func TestTurnIsServerOwnedAndSkipsRemovedPlayers(t *testing.T) {
+	g, out := NewGame(Config{})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	mustConnect(t, g, "carol", RolePlayer)
+	g.HandleMessage(alice, Message{Type: "setTurnOrder", Value: json.RawMessage(`{"order":["alice","bob","carol"]}`)})
+	drain(out)
+
+	g.HandleMessage(bob, Message{Type: "update", Value: json.RawMessage(`{"turn":{"current":"bob"}}`)})
+	require.Equal(t, "alice", turnRow(t, g)["current"])
+
+	require.NoError(t, g.Kick("bob", KickOptions{}))
+	g.HandleMessage(alice, Message{Type: "endTurn"})
+	require.Equal(t, "carol", turnRow(t, g)["current"])
+}
@@ -0,0 +1,238 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// The waiting room: a lobby with a capacity seats at most that many players
+// (host included). Joiners past it are admitted as spectators and queued, in
+// g.Data["lobby"]["waiting"], and each is sent a waiting message with their
+// place in line. Places open up when a player is gone past the offline grace
+// — they give theirs up to the head of the queue and rejoin it at the back —
+// or is kicked or moved to the stands, when the host raises the capacity,
+// or straight away when the host admits someone.
+
+// lobbyValueLocked is g.Data["lobby"]. Caller must hold g.mu.
+func (g *Game) lobbyValueLocked() map[string]any {
+	waiting := make([]any, len(g.waiting))
+	for i, id := range g.waiting {
+		waiting[i] = id
+	}
+	return map[string]any{"capacity": float64(g.capacity), "waiting": waiting}
+}
+
+// playingLocked counts the players holding a place at the table. Caller must
+// hold g.mu.
+func (g *Game) playingLocked() int {
+	n := 0
+	for _, p := range g.Players {
+		if p.Role != RoleSpectator {
+			n++
+		}
+	}
+	return n
+}
+
+// fullLocked reports whether a joiner must wait. Caller must hold g.mu.
+func (g *Game) fullLocked() bool {
+	return g.capacity > 0 && g.playingLocked() >= g.capacity
+}
+
+// waitLocked queues id, if it isn't already. Caller must hold g.mu.
+func (g *Game) waitLocked(id string) {
+	if !slices.Contains(g.waiting, id) {
+		g.waiting = append(g.waiting, id)
+	}
+}
+
+// unwaitLocked drops id from the queue, reporting whether it was there.
+// Caller must hold g.mu.
+func (g *Game) unwaitLocked(id string) bool {
+	i := slices.Index(g.waiting, id)
+	if i < 0 {
+		return false
+	}
+	g.waiting = slices.Delete(g.waiting, i, i+1)
+	return true
+}
+
+// waitingChange is what moving the queue produced, to send once g.mu is
+// released. The zero value sends nothing.
+type waitingChange struct {
+	patch     []byte
+	positions []*PlayerMessage
+	logged    []byte
+}
+
+func (c waitingChange) send(g *Game) {
+	g.sendPresence(c.patch)
+	for _, pm := range c.positions {
+		g.offer(pm)
+	}
+	g.sendLog(c.logged)
+}
+
+// fillLocked moves the queue: while there is room, the first connected
+// waiter is promoted to player; while there is not, a player gone past the
+// grace period gives up their place and goes to the back of the queue. It
+// always returns the lobby patch, so callers that changed the queue
+// themselves can rely on it going out, and logs lines, by actor, ahead of
+// its own. Caller must hold g.mu.
+func (g *Game) fillLocked(actor string, lines ...logLine) waitingChange {
+	var change waitingChange
+	rows := map[string]any{}
+	vacated := map[string]any{}
+	for {
+		next := g.nextWaiterLocked()
+		if next == nil {
+			break
+		}
+		if !g.fullLocked() {
+			g.unwaitLocked(next.ID)
+			next.Role = RolePlayer
+			if g.hostLocked() == nil {
+				next.Role = RoleHost
+			}
+			rows[next.ID] = serverRowLocked(next)
+			lines = append(lines, logLine{"join", next.ID + " took a place at the table"})
+			continue
+		}
+		gone := g.gonePlayerLocked()
+		if gone == nil {
+			break
+		}
+		gone.Role = RoleSpectator
+		row := serverRowLocked(gone)
+		if v := g.vacateSeatLocked(gone); v != nil {
+			row["seat"] = nil
+			for k, taken := range v["taken"].(map[string]any) {
+				vacated[k] = taken
+			}
+		}
+		rows[gone.ID] = row
+		g.waitLocked(gone.ID)
+		lines = append(lines, logLine{"leave", gone.ID + " gave up their place"})
+	}
+
+	patch := map[string]any{"lobby": g.lobbyValueLocked()}
+	if len(rows) > 0 {
+		patch["players"] = rows
+	}
+	if len(vacated) > 0 {
+		patch["seats"] = map[string]any{"taken": vacated}
+	}
+	change.patch = g.mergeServerPatchLocked(actor, patch)
+	change.positions = g.positionsLocked()
+	change.logged = g.recordLocked(actor, lines...)
+	return change
+}
+
+// nextWaiterLocked is the first connected player in the queue. Caller must
+// hold g.mu.
+func (g *Game) nextWaiterLocked() *Player {
+	for _, id := range g.waiting {
+		if p, ok := g.Players[id]; ok && p.Connected {
+			return p
+		}
+	}
+	return nil
+}
+
+// gonePlayerLocked is a player — never the host — who has been offline past
+// the grace period, the longest-seated first. Caller must hold g.mu.
+func (g *Game) gonePlayerLocked() *Player {
+	var gone *Player
+	for id, p := range g.Players {
+		if p.Role != RolePlayer || p.Connected {
+			continue
+		}
+		if _, grace := g.offlineTimers[id]; grace {
+			continue
+		}
+		if gone == nil || p.JoinTimestamp < gone.JoinTimestamp ||
+			(p.JoinTimestamp == gone.JoinTimestamp && p.ID < gone.ID) {
+			gone = p
+		}
+	}
+	return gone
+}
+
+// positionsLocked tells every connected waiter their place in the queue,
+// counting from 1. Caller must hold g.mu.
+func (g *Game) positionsLocked() []*PlayerMessage {
+	var msgs []*PlayerMessage
+	now := time.Now().UnixMilli()
+	for i, id := range g.waiting {
+		if p, ok := g.Players[id]; !ok || !p.Connected {
+			continue
+		}
+		value, _ := json.Marshal(map[string]int{"position": i + 1, "of": len(g.waiting)})
+		payload, _ := json.Marshal(Message{
+			Type:      "waiting",
+			PlayerID:  id,
+			Timestamp: now,
+			Value:     value,
+		})
+		msgs = append(msgs, &PlayerMessage{To: []string{id}, Content: payload, Type: "waiting"})
+	}
+	return msgs
+}
+
+// capacityValue is the payload of setCapacity and admit.
+type capacityValue struct {
+	Capacity *int   `json:"capacity,omitempty"`
+	Player   string `json:"player,omitempty"`
+}
+
+// waitingRoom handles the host's setCapacity and admit messages. Admitting
+// someone seats them whatever the capacity says.
+func (g *Game) waitingRoom(from *Player, msg Message) {
+	var v capacityValue
+	if msg.Value == nil || json.Unmarshal(msg.Value, &v) != nil {
+		g.sendError(from.ID, msg.Type, "invalid", "malformed "+msg.Type)
+		return
+	}
+
+	g.mu.Lock()
+	var (
+		line     logLine
+		admitted []byte
+		err      *rejection
+	)
+	switch msg.Type {
+	case "setCapacity":
+		if v.Capacity == nil || *v.Capacity < 0 {
+			err = &rejection{"invalid", errors.New("setCapacity needs a capacity of 0 (no limit) or more")}
+			break
+		}
+		g.capacity = *v.Capacity
+		line = logLine{"lobby", fmt.Sprintf("%s set the table to %d players", from.ID, g.capacity)}
+		if g.capacity == 0 {
+			line.text = from.ID + " removed the player limit"
+		}
+	case "admit":
+		p, ok := g.Players[v.Player]
+		if !ok || !g.unwaitLocked(v.Player) {
+			err = &rejection{"unknown_player", fmt.Errorf("not waiting: %s", v.Player)}
+			break
+		}
+		p.Role = RolePlayer
+		admitted = g.mergeRolesLocked(p)
+		line = logLine{"join", fmt.Sprintf("%s admitted %s to the table", from.ID, p.ID)}
+	}
+	if err != nil {
+		g.mu.Unlock()
+		g.sendError(from.ID, msg.Type, err.code, err.Error())
+		return
+	}
+	change := g.fillLocked(from.ID, line)
+	g.LastActivity = time.Now()
+	g.mu.Unlock()
+
+	g.sendPresence(admitted)
+	change.send(g)
+}
@@ -0,0 +1,102 @@
+package game
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func waitingQueue(t *testing.T, g *Game) []any {
+	t.Helper()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.Data["lobby"].(map[string]any)["waiting"].([]any)
+}
+
+func roleOf(g *Game, id string) Role {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.Players[id].Role
+}
+
+func TestJoinersPastCapacityWaitInLine(t *testing.T) {
+	g, out := NewGame(Config{Capacity: 2})
+	mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	carol := mustConnect(t, g, "carol", RolePlayer)
+	require.Equal(t, RoleSpectator, carol.Role)
+	pm, m := nextOfType(t, out, "waiting")
+	require.Equal(t, []string{"carol"}, pm.To)
+	require.JSONEq(t, `{"position":1,"of":1}`, string(m.Value))
+
+	mustConnect(t, g, "dave", RolePlayer)
+	mustConnect(t, g, "eve", RoleSpectator) // watching, not waiting
+	require.Equal(t, []any{"carol", "dave"}, waitingQueue(t, g))
+}
+
+func TestPlayerGonePastGraceGivesUpTheirPlace(t *testing.T) {
+	g, out := NewGame(Config{Capacity: 2, OfflineGrace: 20 * time.Millisecond})
+	mustConnect(t, g, "alice", RolePlayer)
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	g.HandleMessage(bob, Message{Type: "claimSeat", Value: json.RawMessage(`{"seat":1}`)})
+	mustConnect(t, g, "carol", RolePlayer)
+	drain(out)
+
+	g.DisconnectPlayer(bob)
+	require.Eventually(t, func() bool { return roleOf(g, "carol") == RolePlayer }, time.Second, 5*time.Millisecond)
+	require.Equal(t, RoleSpectator, roleOf(g, "bob"))
+	require.Equal(t, []any{"bob"}, waitingQueue(t, g), "bob rejoins the line at the back")
+	require.Empty(t, seatsTaken(t, g))
+	require.Contains(t, logTexts(g), "carol took a place at the table")
+
+	// back before anyone else: still waiting, told where they stand
+	mustConnect(t, g, "bob", RolePlayer)
+	pm, m := nextOfType(t, out, "waiting")
+	require.Equal(t, []string{"bob"}, pm.To)
+	require.JSONEq(t, `{"position":1,"of":1}`, string(m.Value))
+}
+
+func TestHostAdmitsAndResizesTheTable(t *testing.T) {
+	g, out := NewGame(Config{Capacity: 1})
+	alice := mustConnect(t, g, "alice", RolePlayer)
+	bob := mustConnect(t, g, "bob", RolePlayer)
+	mustConnect(t, g, "carol", RolePlayer)
+	mustConnect(t, g, "dave", RolePlayer)
+	drain(out)
+
+	g.HandleMessage(bob, Message{Type: "admit", Value: json.RawMessage(`{"player":"bob"}`)})
+	_, m := nextOfType(t, out, "error")
+	require.Equal(t, "forbidden", errorCode(t, m))
+
+	g.HandleMessage(alice, Message{Type: "admit", Value: json.RawMessage(`{"player":"carol"}`)})
+	require.Equal(t, RolePlayer, roleOf(g, "carol"), "admitting ignores the capacity")
+	require.Equal(t, []any{"bob", "dave"}, waitingQueue(t, g))
+
+	g.HandleMessage(alice, Message{Type: "setCapacity", Value: json.RawMessage(`{"capacity":3}`)})
+	require.Equal(t, RolePlayer, roleOf(g, "bob"))
+	require.Equal(t, RoleSpectator, roleOf(g, "dave"))
+	require.Equal(t, []any{"dave"}, waitingQueue(t, g))
+
+	// a player moved to the stands makes room too
+	g.HandleMessage(alice, Message{Type: "setRole", Value: json.RawMessage(`{"player":"bob","role":"spectator"}`)})
+	require.Equal(t, RolePlayer, roleOf(g, "dave"))
+	require.Empty(t, waitingQueue(t, g))
+}
+
+func TestResetKeepsTheWaitingRoom(t *testing.T) {
+	g, out := NewGame(Config{Capacity: 1})
+	mustConnect(t, g, "alice", RolePlayer)
+	mustConnect(t, g, "bob", RolePlayer)
+	drain(out)
+
+	require.NoError(t, g.Reset(map[string]any{"decks": map[string]any{}}))
+	_, m := nextOfType(t, out, "sync")
+	var synced map[string]any
+	require.NoError(t, json.Unmarshal(m.Value, &synced))
+	require.Equal(t, map[string]any{"capacity": float64(1), "waiting": []any{"bob"}}, synced["lobby"])
+	require.Equal(t, []any{"bob"}, waitingQueue(t, g))
+}
@@ -32,6 +32,33 @@ func MergeMaps(dst, patch map[string]any) map[string]any {
 	return dst
 }
 
+// Inverse returns the patch that undoes merging patch into dst, so that
+// MergeMaps(MergeMaps(dst, patch), Inverse(dst, patch)) restores dst. Take it
+// before the merge. Replaced subtrees are referenced rather than copied —
+// safe, since MergeMaps swaps them out instead of editing them.
+func Inverse(dst, patch map[string]any) map[string]any {
+	inv := make(map[string]any, len(patch))
+	for k, v := range patch {
+		old, exists := dst[k]
+		if !exists {
+			if v != nil {
+				inv[k] = nil
+			}
+			continue
+		}
+		if pm, ok := v.(map[string]any); ok {
+			if dm, ok := old.(map[string]any); ok {
+				if sub := Inverse(dm, pm); len(sub) > 0 {
+					inv[k] = sub
+				}
+				continue
+			}
+		}
+		inv[k] = old
+	}
+	return inv
+}
+
 // Patch merges two JSON object documents. The hot path decodes state once and
 // uses MergeMaps directly; this remains for tools/tests operating on raw JSON.
 func Patch(original json.RawMessage, patch json.RawMessage) (json.RawMessage, error) {
@@ -67,3 +67,30 @@ func TestPatchClientSemantics(t *testing.T) {
 		})
 	}
 }
+
+// merging a patch and then its inverse must give back the original document
+func TestInverseRestoresOriginal(t *testing.T) {
+	cases := []struct{ name, a, b string }{
+		{"add a key", `{"cards":{}}`, `{"cards":{"c1":{"position":[1,2,3]}}}`},
+		{"delete a key", `{"cards":{"c1":{"position":[1,2,3]},"c2":{}}}`, `{"cards":{"c1":null}}`},
+		{"replace nested scalar", `{"cards":{"c1":{"position":[1,2,3],"faceImageUrl":"x"}}}`, `{"cards":{"c1":{"position":[7,8,9]}}}`},
+		{"object over scalar", `{"overlay":"none"}`, `{"overlay":{"imageUrl":"y"}}`},
+		{"scalar over object", `{"overlay":{"imageUrl":"y"}}`, `{"overlay":false}`},
+		{"delete absent key", `{"a":1}`, `{"b":null}`},
+		{"empty patch object", `{"players":{"p1":{"seat":1}}}`, `{"players":{"p1":{}}}`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var dst, patch map[string]any
+			require.NoError(t, json.Unmarshal([]byte(tc.a), &dst))
+			require.NoError(t, json.Unmarshal([]byte(tc.b), &patch))
+
+			inv := jsonmerge.Inverse(dst, patch)
+			merged := jsonmerge.MergeMaps(dst, patch)
+			restored, err := json.Marshal(jsonmerge.MergeMaps(merged, inv))
+			require.NoError(t, err)
+			require.JSONEq(t, tc.a, string(restored))
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package lobby
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jollygrin/tts-server/game"
+	"github.com/rs/zerolog/log"
+)
+
+// adminRouter is the JSON admin API, mounted at /admin. Every route takes the
+// admin token as an Authorization: Bearer header; like the HTML pages, it
+// answers 404 to everyone else.
+func (srv *Lobbies) adminRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !srv.bearerAdmin(r) {
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Get("/lobbies", srv.adminLobbies)
+	r.Get("/lobbies/{lobby}", srv.adminLobby)
+	r.Get("/lobbies/{lobby}/players", srv.adminPlayers)
+	r.Post("/lobbies/{lobby}/patch", srv.adminPatch)
+	r.Post("/lobbies/{lobby}/reset", srv.adminReset)
+	r.Post("/lobbies/{lobby}/sync", srv.adminSync)
+	r.Get("/lobbies/{lobby}/events", srv.adminEvents)
+	r.Delete("/lobbies/{lobby}", srv.adminClose)
+	r.Get("/runtime", srv.adminRuntime)
+	r.Get("/goroutines", srv.adminGoroutines)
+	return r
+}
+
+// adminBodyLimit caps uploaded patches and GameDTOs.
+const adminBodyLimit = 16 << 20
+
+// lobbyJSON is a lobby's game.Stats plus its live socket count.
+type lobbyJSON struct {
+	ID              string            `json:"id"`
+	Clients         int               `json:"clients"`
+	Players         []game.PlayerStat `json:"players"`
+	StateBytes      int               `json:"stateBytes"`
+	Updates         int64             `json:"updates"`
+	CreatedAt       time.Time         `json:"createdAt"`
+	LastActivity    time.Time         `json:"lastActivity"`
+	RejectedPlayers int64             `json:"rejectedPlayers"`
+	RejectedUpdates int64             `json:"rejectedUpdates"`
+	Banned          []string          `json:"banned"`
+}
+
+func newLobbyJSON(l *Lobby) lobbyJSON {
+	stats := l.state.Stats()
+	players := stats.Players
+	if players == nil {
+		players = []game.PlayerStat{}
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].ID < players[j].ID })
+	banned := stats.Banned
+	if banned == nil {
+		banned = []string{}
+	}
+	return lobbyJSON{
+		ID:              l.ID,
+		Clients:         l.clientCount(),
+		Players:         players,
+		StateBytes:      stats.StateBytes,
+		Updates:         stats.Updates,
+		CreatedAt:       stats.CreatedAt,
+		LastActivity:    stats.LastActivity,
+		RejectedPlayers: stats.RejectedPlayers,
+		RejectedUpdates: stats.RejectedUpdates,
+		Banned:          banned,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Err(err).Msg("Failed to write admin response")
+	}
+}
+
+// lookup finds the {lobby} in the route, answering 404 when it doesn't exist.
+func (srv *Lobbies) lookup(w http.ResponseWriter, r *http.Request) (*Lobby, bool) {
+	srv.lobbiesMu.RLock()
+	l, ok := srv.lobbies[chi.URLParam(r, "lobby")]
+	srv.lobbiesMu.RUnlock()
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no such lobby"})
+	}
+	return l, ok
+}
+
+func (srv *Lobbies) adminLobbies(w http.ResponseWriter, r *http.Request) {
+	// copy lobby refs under the map lock, gather stats after releasing it
+	srv.lobbiesMu.RLock()
+	lobbies := make([]*Lobby, 0, len(srv.lobbies))
+	for _, l := range srv.lobbies {
+		lobbies = append(lobbies, l)
+	}
+	srv.lobbiesMu.RUnlock()
+
+	out := make([]lobbyJSON, 0, len(lobbies))
+	for _, l := range lobbies {
+		out = append(out, newLobbyJSON(l))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	writeJSON(w, http.StatusOK, map[string]any{
+		"lobbies": out,
+		"quotas":  srv.QuotaStats(),
+	})
+}
+
+func (srv *Lobbies) adminLobby(w http.ResponseWriter, r *http.Request) {
+	if l, ok := srv.lookup(w, r); ok {
+		writeJSON(w, http.StatusOK, newLobbyJSON(l))
+	}
+}
+
+func (srv *Lobbies) adminPlayers(w http.ResponseWriter, r *http.Request) {
+	if l, ok := srv.lookup(w, r); ok {
+		writeJSON(w, http.StatusOK, map[string]any{"players": newLobbyJSON(l).Players})
+	}
+}
+
+// adminError answers a failed write: a refused patch (bad ownership, state too
+// large) is the caller's problem, anything else ours.
+func adminError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, game.ErrStateTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.As(err, new(*json.SyntaxError)), errors.As(err, new(*json.UnmarshalTypeError)):
+		status = http.StatusBadRequest
+	case errors.As(err, new(*http.MaxBytesError)):
+		status = http.StatusRequestEntityTooLarge
+	default:
+		if game.IsRejection(err) {
+			status = http.StatusBadRequest
+		}
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// adminPatch merges the request body into the lobby state and broadcasts it,
+// exactly like a client update.
+func (srv *Lobbies) adminPatch(w http.ResponseWriter, r *http.Request) {
+	l, ok := srv.lookup(w, r)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, adminBodyLimit))
+	if err != nil {
+		adminError(w, err)
+		return
+	}
+	if err := l.state.Patch(body); err != nil {
+		adminError(w, err)
+		return
+	}
+	log.Info().Str("lobby", l.ID).Int("bytes", len(body)).Msg("Admin patched lobby state")
+	writeJSON(w, http.StatusOK, newLobbyJSON(l))
+}
+
+// adminReset empties the table, or replaces it with the GameDTO in the body,
+// and re-syncs every client.
+func (srv *Lobbies) adminReset(w http.ResponseWriter, r *http.Request) {
+	l, ok := srv.lookup(w, r)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, adminBodyLimit))
+	if err != nil {
+		adminError(w, err)
+		return
+	}
+	var state map[string]any
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &state); err != nil {
+			adminError(w, err)
+			return
+		}
+	}
+	if err := l.state.Reset(state); err != nil {
+		adminError(w, err)
+		return
+	}
+	log.Info().Str("lobby", l.ID).Bool("empty", state == nil).Msg("Admin reset lobby state")
+	writeJSON(w, http.StatusOK, newLobbyJSON(l))
+}
+
+// adminSync sends every client in the lobby a fresh sync.
+func (srv *Lobbies) adminSync(w http.ResponseWriter, r *http.Request) {
+	l, ok := srv.lookup(w, r)
+	if !ok {
+		return
+	}
+	if err := l.state.SyncAll(); err != nil {
+		adminError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newLobbyJSON(l))
+}
+
+// adminClose closes the lobby now instead of waiting out the empty-lobby TTL.
+func (srv *Lobbies) adminClose(w http.ResponseWriter, r *http.Request) {
+	if _, ok := srv.closeLobby(chi.URLParam(r, "lobby"), "lobby closed by an admin"); !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no such lobby"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
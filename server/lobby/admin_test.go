@@ -0,0 +1,182 @@
+package lobby
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/jollygrin/tts-server/game"
+	"github.com/stretchr/testify/require"
+)
+
+func adminGet(t *testing.T, url, token string, into any) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if into != nil && resp.StatusCode == http.StatusOK {
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(into))
+	}
+	return resp.StatusCode
+}
+
+func TestAdminAPIRequiresBearerToken(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{})
+
+	require.Equal(t, http.StatusNotFound, adminGet(t, ts.URL+"/admin/lobbies", "", nil))
+	require.Equal(t, http.StatusNotFound, adminGet(t, ts.URL+"/admin/lobbies", "wrong", nil))
+	// the query-string token the HTML pages accept is not enough here
+	require.Equal(t, http.StatusNotFound, adminGet(t, ts.URL+"/admin/lobbies?token=secret", "", nil))
+	require.Equal(t, http.StatusOK, adminGet(t, ts.URL+"/admin/lobbies", "secret", nil))
+
+	// …while the HTML pages now take the header too
+	require.Equal(t, http.StatusOK, adminGet(t, ts.URL+"/view", "secret", nil))
+}
+
+func TestAdminAPIListsLobbiesAndPlayers(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{})
+	requireOpen(t, dial(t, ts, "beta", "bob", nil))
+	requireOpen(t, dial(t, ts, "alpha", "alice", nil))
+	requireOpen(t, dial(t, ts, "alpha", "carol", nil))
+
+	var list struct {
+		Lobbies []lobbyJSON `json:"lobbies"`
+		Quotas  QuotaStats  `json:"quotas"`
+	}
+	require.Equal(t, http.StatusOK, adminGet(t, ts.URL+"/admin/lobbies", "secret", &list))
+	require.Len(t, list.Lobbies, 2)
+	require.Equal(t, "alpha", list.Lobbies[0].ID)
+	require.Equal(t, 2, list.Lobbies[0].Clients)
+	require.Positive(t, list.Lobbies[0].StateBytes)
+	require.False(t, list.Lobbies[0].CreatedAt.IsZero())
+
+	var one lobbyJSON
+	require.Equal(t, http.StatusOK, adminGet(t, ts.URL+"/admin/lobbies/beta", "secret", &one))
+	require.Equal(t, "beta", one.ID)
+	require.Equal(t, []string{}, one.Banned)
+
+	var players struct {
+		Players []struct {
+			ID        string `json:"id"`
+			Connected bool   `json:"connected"`
+			Role      string `json:"role"`
+		} `json:"players"`
+	}
+	require.Equal(t, http.StatusOK, adminGet(t, ts.URL+"/admin/lobbies/alpha/players", "secret", &players))
+	require.Len(t, players.Players, 2)
+	require.Equal(t, "alice", players.Players[0].ID)
+	require.Equal(t, "host", players.Players[0].Role)
+	require.True(t, players.Players[0].Connected)
+	require.Equal(t, "carol", players.Players[1].ID)
+
+	require.Equal(t, http.StatusNotFound, adminGet(t, ts.URL+"/admin/lobbies/nope", "secret", nil))
+}
+
+func adminDo(t *testing.T, method, url, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	out, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(out)
+}
+
+// nextMessage reads until a message of the given type arrives.
+func nextMessage(t *testing.T, conn *websocket.Conn, want string) game.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for {
+		var m game.Message
+		require.NoError(t, wsjson.Read(ctx, conn, &m))
+		if m.Type == want {
+			return m
+		}
+	}
+}
+
+func TestAdminPatchBroadcasts(t *testing.T) {
+	srv, ts := quotaServer(t, Quotas{})
+	conn := dial(t, ts, "wedged", "alice", nil)
+	nextMessage(t, conn, "sync")
+
+	code, _ := adminDo(t, http.MethodPost, ts.URL+"/admin/lobbies/wedged/patch",
+		`{"decks":{"d1":{"cards":[]}},"players":{"alice":{"connected":false,"tray":{}}}}`)
+	require.Equal(t, http.StatusOK, code)
+
+	m := nextMessage(t, conn, "update")
+	require.Equal(t, game.AdminID, m.PlayerID)
+	require.JSONEq(t, `{"decks":{"d1":{"cards":[]}},"players":{"alice":{"tray":{}}}}`, string(m.Value),
+		"server-owned fields are dropped for admins too")
+
+	l, _ := srv.lobby("wedged")
+	require.Equal(t, true, l.state.Stats().Players[0].Connected)
+
+	code, _ = adminDo(t, http.MethodPost, ts.URL+"/admin/lobbies/wedged/patch", `not json`)
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = adminDo(t, http.MethodPost, ts.URL+"/admin/lobbies/wedged/patch", `{"players":null}`)
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = adminDo(t, http.MethodPost, ts.URL+"/admin/lobbies/nope/patch", `{}`)
+	require.Equal(t, http.StatusNotFound, code)
+}
+
+func TestAdminResetAndSync(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{})
+	conn := dial(t, ts, "reset", "alice", nil)
+	nextMessage(t, conn, "sync")
+
+	code, _ := adminDo(t, http.MethodPost, ts.URL+"/admin/lobbies/reset/reset",
+		`{"cards":{"c1":{"position":[1,2,3]}},"players":{"alice":{"role":"spectator","seat":1}}}`)
+	require.Equal(t, http.StatusOK, code)
+	m := nextMessage(t, conn, "sync")
+	var state map[string]any
+	require.NoError(t, json.Unmarshal(m.Value, &state))
+	require.Contains(t, state, "cards")
+	alice := state["players"].(map[string]any)["alice"].(map[string]any)
+	require.Equal(t, float64(1), alice["seat"])
+	require.Equal(t, "host", alice["role"], "an uploaded role can't override the live one")
+	require.Equal(t, true, alice["connected"])
+
+	// an empty body empties the table
+	code, _ = adminDo(t, http.MethodPost, ts.URL+"/admin/lobbies/reset/reset", "")
+	require.Equal(t, http.StatusOK, code)
+	m = nextMessage(t, conn, "sync")
+	require.NotContains(t, string(m.Value), "cards")
+
+	code, _ = adminDo(t, http.MethodPost, ts.URL+"/admin/lobbies/reset/sync", "")
+	require.Equal(t, http.StatusOK, code)
+	nextMessage(t, conn, "sync")
+}
+
+func TestAdminCloseLobby(t *testing.T) {
+	srv, ts := quotaServer(t, Quotas{})
+	conn := dial(t, ts, "doomed", "alice", nil)
+	requireOpen(t, conn)
+
+	code, _ := adminDo(t, http.MethodDelete, ts.URL+"/admin/lobbies/doomed", "")
+	require.Equal(t, http.StatusNoContent, code)
+	requireClosedWith(t, conn, websocket.StatusGoingAway, "lobby closed by an admin")
+
+	srv.lobbiesMu.RLock()
+	require.NotContains(t, srv.lobbies, "doomed")
+	srv.lobbiesMu.RUnlock()
+
+	code, _ = adminDo(t, http.MethodDelete, ts.URL+"/admin/lobbies/doomed", "")
+	require.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,31 @@
+package lobby
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket/wsjson"
+	"github.com/jollygrin/tts-server/game"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoinerGetsChatHistoryAfterSync(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{})
+	alice := dial(t, ts, "chatty", "alice", nil)
+	nextMessage(t, alice, "sync")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, wsjson.Write(ctx, alice, game.Message{Type: "chat", Value: []byte(`{"text":"anyone?"}`)}))
+	nextMessage(t, alice, "chat")
+
+	bob := dial(t, ts, "chatty", "bob", nil)
+	var m game.Message
+	for m.Type != "sync" {
+		require.NoError(t, wsjson.Read(ctx, bob, &m))
+		require.NotEqual(t, "chatHistory", m.Type, "history comes after the sync")
+	}
+	m = nextMessage(t, bob, "chatHistory")
+	require.Contains(t, string(m.Value), "anyone?")
+}
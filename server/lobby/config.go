@@ -0,0 +1,140 @@
+package lobby
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/jollygrin/tts-server/clock"
+	"github.com/jollygrin/tts-server/game"
+)
+
+// Config is everything New needs. Start from DefaultConfig and override what
+// you need; tests use this to build servers with tight limits.
+type Config struct {
+	// AdminToken gates the admin pages and API; empty means they don't exist.
+	AdminToken string
+	// Origins are the host patterns of pages allowed to open sockets. They're
+	// matched by websocket.Accept against the Origin host (port included)
+	// with path.Match, so "localhost:*" covers every dev port. Requests
+	// without an Origin header (non-browser clients) and same-host pages are
+	// always allowed.
+	Origins []string
+	Quotas  Quotas
+	// TrustedProxies are the CIDRs (or single addresses) of the proxies in
+	// front of the server, whose X-Forwarded-For entries are believed when
+	// counting and banning addresses. Empty turns Quotas.MaxConnsPerIP and
+	// address bans off; see clientIP.
+	TrustedProxies []string
+	// Game is handed to every new lobby's game; its Limits apply per lobby.
+	Game game.Config
+	// EmptyLobbyTTL is how long an empty lobby survives before it's
+	// garbage-collected — long enough that a full-lobby refresh/reconnect
+	// doesn't lose the game state.
+	EmptyLobbyTTL time.Duration
+	// ReadLimit caps one inbound websocket message. Scenario seeds and TTS
+	// deck imports carry full card lists and blow past the library's 32KB
+	// default; a failed read silently drops the update AND the client.
+	ReadLimit int64
+	// SendBuffer is each client's outbound queue; messages for a client whose
+	// queue is full are dropped.
+	SendBuffer int
+	// WriteTimeout bounds each websocket write, so a socket that stops
+	// accepting data can't block its writer forever.
+	WriteTimeout time.Duration
+	// StallTimeout is how long a client may go on missing messages before
+	// it's disconnected. One whose buffer drains sooner gets a fresh sync.
+	StallTimeout time.Duration
+	// The server pings every client each PingInterval; one that doesn't pong
+	// within PongTimeout is treated as gone, so a half-open connection
+	// doesn't keep its player "connected" until the OS notices.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	// Clock schedules the pings and runs the game clocks; tests swap in a
+	// clock.Fake.
+	Clock clock.Clock
+	// MessageRate (per second) and MessageBurst size each client's token
+	// bucket. A client that empties it is disconnected.
+	MessageRate  float64
+	MessageBurst int
+}
+
+// DefaultConfig is the server as deployed: generous for real tables and still
+// stopping a runaway script.
+func DefaultConfig() Config {
+	g := game.DefaultConfig
+	g.Limits = game.Limits{MaxPlayers: 32, MaxStateBytes: 8 << 20}
+	return Config{
+		Origins:       append([]string(nil), defaultOriginPatterns...),
+		Quotas:        DefaultQuotas,
+		Game:          g,
+		EmptyLobbyTTL: 15 * time.Minute,
+		ReadLimit:     1 << 20,
+		SendBuffer:    256,
+		WriteTimeout:  10 * time.Second,
+		StallTimeout:  10 * time.Second,
+		PingInterval:  20 * time.Second,
+		PongTimeout:   10 * time.Second,
+		Clock:         clock.Real{},
+		MessageRate:   7,
+		MessageBurst:  15,
+	}
+}
+
+// Validate reports every setting New can't run with.
+func (c Config) Validate() error {
+	var errs []error
+	for _, p := range c.Origins {
+		if _, err := path.Match(p, ""); err != nil || p == "" {
+			errs = append(errs, fmt.Errorf("malformed allowed origin %q", p))
+		}
+		if p == "*" {
+			// the library refuses to treat * as "anyone" for a reason
+			errs = append(errs, errors.New(`allowed origin "*" is not supported: list the sites instead`))
+		}
+	}
+	if _, err := parseProxies(c.TrustedProxies); err != nil {
+		errs = append(errs, err)
+	}
+	for name, v := range map[string]int{
+		"max lobbies":            c.Quotas.MaxLobbies,
+		"max clients per lobby":  c.Quotas.MaxClientsPerLobby,
+		"max connections per IP": c.Quotas.MaxConnsPerIP,
+		"max players per lobby":  c.Game.Limits.MaxPlayers,
+		"max state bytes":        c.Game.Limits.MaxStateBytes,
+		"capacity":               c.Game.Capacity,
+	} {
+		if v < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative (0 = unlimited)", name))
+		}
+	}
+	positive := []struct {
+		name string
+		ok   bool
+	}{
+		{"offline grace", c.Game.OfflineGrace > 0},
+		{"game buffer", c.Game.OutBuffer > 0},
+		{"chat history", c.Game.ChatHistory > 0},
+		{"chat length", c.Game.ChatLength > 0},
+		{"log history", c.Game.LogHistory > 0},
+		{"clock tick", c.Game.ClockTick > 0},
+		{"seats", c.Game.Seats > 0},
+		{"empty lobby TTL", c.EmptyLobbyTTL > 0},
+		{"read limit", c.ReadLimit > 0},
+		{"send buffer", c.SendBuffer > 0},
+		{"write timeout", c.WriteTimeout > 0},
+		{"stall timeout", c.StallTimeout > 0},
+		{"ping interval", c.PingInterval > 0},
+		{"pong timeout", c.PongTimeout > 0},
+		{"clock", c.Clock != nil},
+		{"message rate", c.MessageRate > 0},
+		{"message burst", c.MessageBurst > 0},
+	}
+	for _, p := range positive {
+		if !p.ok {
+			errs = append(errs, fmt.Errorf("%s must be positive", p.name))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,105 @@
+package lobby
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/jollygrin/tts-server/game"
+	"github.com/stretchr/testify/require"
+)
+
+// wsPair returns both ends of a real websocket: the server end to hand a
+// Client, the dialed end to watch what it's sent.
+func wsPair(t *testing.T) (server, client *websocket.Conn) {
+	t.Helper()
+	accepted := make(chan *websocket.Conn, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		require.NoError(t, err)
+		accepted <- conn
+		<-r.Context().Done()
+	}))
+	t.Cleanup(ts.Close)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	client, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.CloseNow() })
+	server = <-accepted
+	t.Cleanup(func() { server.CloseNow() })
+	return server, client
+}
+
+// stalledClient enters a client into l with a one-message send buffer and no
+// writer, so nothing drains it unless the test does.
+func stalledClient(t *testing.T, l *Lobby, id string, conn *websocket.Conn) *Client {
+	t.Helper()
+	player, err := l.state.ConnectPlayer(id, "", game.RolePlayer)
+	require.NoError(t, err)
+	c := &Client{ID: id, Conn: conn, Send: make(chan []byte, 1), Player: player}
+	l.mu.Lock()
+	l.clients[c] = struct{}{}
+	l.mu.Unlock()
+	return c
+}
+
+func receive(t *testing.T, c *Client) game.Message {
+	t.Helper()
+	select {
+	case raw := <-c.Send:
+		var m game.Message
+		require.NoError(t, json.Unmarshal(raw, &m))
+		return m
+	case <-time.After(2 * time.Second):
+		t.Fatal("nothing was sent")
+		return game.Message{}
+	}
+}
+
+func TestClientThatMissedMessagesIsResynced(t *testing.T) {
+	cfg := testConfig()
+	cfg.StallTimeout = 200 * time.Millisecond
+	l := newLobby("dirty", cfg)
+	defer l.Close()
+	alice := stalledClient(t, l, "alice", nil)
+	receive(t, alice) // alice's own presence; her join in the game log may be dropped already
+
+	require.NoError(t, l.state.Patch([]byte(`{"a":1}`)))
+	require.NoError(t, l.state.Patch([]byte(`{"b":2}`))) // dropped: the buffer is full
+	require.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return !alice.dirtySince.IsZero()
+	}, time.Second, 5*time.Millisecond)
+
+	// whatever is still buffered comes first; a drained client then gets the
+	// full state
+	for {
+		m := receive(t, alice)
+		if m.Type == "sync" && strings.Contains(string(m.Value), `"b":2`) {
+			break
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	require.True(t, alice.dirtySince.IsZero())
+}
+
+func TestStalledClientIsDisconnected(t *testing.T) {
+	cfg := testConfig()
+	cfg.StallTimeout = 100 * time.Millisecond
+	l := newLobby("stalled", cfg)
+	defer l.Close()
+	server, conn := wsPair(t)
+	stalledClient(t, l, "alice", server) // its presence fills the buffer
+
+	require.NoError(t, l.state.Patch([]byte(`{"a":1}`)))
+	requireClosedWith(t, conn, websocket.StatusTryAgainLater, "connection too slow, reconnect to catch up")
+}
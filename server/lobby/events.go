@@ -0,0 +1,81 @@
+package lobby
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jollygrin/tts-server/game"
+	"github.com/rs/zerolog/log"
+)
+
+// eventsHeartbeat is how often an idle event stream gets a comment line, so
+// proxies don't time it out.
+const eventsHeartbeat = 15 * time.Second
+
+// splitList parses a comma-separated query value, dropping empty entries.
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// adminEvents streams the lobby's game.Events as Server-Sent Events until the
+// admin hangs up or the lobby closes. ?kind=, ?type= and ?player= take
+// comma-separated lists to narrow the stream.
+func (srv *Lobbies) adminEvents(w http.ResponseWriter, r *http.Request) {
+	l, ok := srv.lookup(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming unsupported"})
+		return
+	}
+
+	q := r.URL.Query()
+	events, unsubscribe := l.state.Events().Subscribe(game.EventFilter{
+		Kinds:   splitList(q.Get("kind")),
+		Types:   splitList(q.Get("type")),
+		Players: splitList(q.Get("player")),
+	})
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": streaming lobby "+l.ID+"\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case e, ok := <-events:
+			if !ok {
+				fmt.Fprint(w, "event: closed\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Err(err).Msg("Failed to marshal lobby event")
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Kind, data)
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,132 @@
+package lobby
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/jollygrin/tts-server/game"
+	"github.com/stretchr/testify/require"
+)
+
+// sseEvent is one parsed Server-Sent Event.
+type sseEvent struct {
+	name string
+	data string
+}
+
+// openEvents subscribes to a lobby's admin event stream and returns its
+// events as they arrive.
+func openEvents(t *testing.T, url string) <-chan sseEvent {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	r := bufio.NewReader(resp.Body)
+	// the opening comment means the subscription is in place
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(line, ":"))
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+		var e sseEvent
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				e.name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				e.data = strings.TrimPrefix(line, "data: ")
+			case line == "" && e.name != "":
+				events <- e
+				e = sseEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan sseEvent) (string, game.Event) {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		require.True(t, ok, "event stream ended")
+		var ev game.Event
+		require.NoError(t, json.Unmarshal([]byte(e.data), &ev))
+		return e.name, ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event arrived")
+		return "", game.Event{}
+	}
+}
+
+func TestAdminEventsStreamFiltered(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{})
+	alice := dial(t, ts, "traced", "alice", nil)
+	bob := dial(t, ts, "traced", "bob", nil)
+	nextMessage(t, alice, "sync")
+	nextMessage(t, bob, "sync")
+
+	require.Equal(t, http.StatusNotFound,
+		adminGet(t, ts.URL+"/admin/lobbies/traced/events", "", nil))
+	events := openEvents(t, ts.URL+"/admin/lobbies/traced/events?kind=inbound,patch&player=alice")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	// bob is filtered out; camera is inbound but never merged
+	require.NoError(t, wsjson.Write(ctx, bob, game.Message{Type: "update", Value: json.RawMessage(`{"x":1}`)}))
+	require.NoError(t, wsjson.Write(ctx, alice, game.Message{Type: "camera", Value: json.RawMessage(`{}`)}))
+	require.NoError(t, wsjson.Write(ctx, alice, game.Message{Type: "update", Value: json.RawMessage(`{"y":2}`)}))
+
+	name, e := nextEvent(t, events)
+	require.Equal(t, game.EventInbound, name)
+	require.Equal(t, "camera", e.Type)
+	require.Equal(t, "alice", e.Player)
+
+	name, e = nextEvent(t, events)
+	require.Equal(t, game.EventInbound, name)
+	require.Equal(t, "update", e.Type)
+
+	name, e = nextEvent(t, events)
+	require.Equal(t, game.EventPatch, name)
+	require.JSONEq(t, `{"y":2}`, string(e.Value))
+}
+
+func TestAdminEventsEndWithLobby(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{})
+	alice := dial(t, ts, "brief", "alice", nil)
+	requireOpen(t, alice)
+	events := openEvents(t, ts.URL+"/admin/lobbies/brief/events?kind=presence")
+
+	code, _ := adminDo(t, http.MethodDelete, ts.URL+"/admin/lobbies/brief", "")
+	require.Equal(t, http.StatusNoContent, code)
+	// the lobby stops once alice has answered the close
+	requireClosedWith(t, alice, websocket.StatusGoingAway, "lobby closed by an admin")
+
+	for e := range events {
+		if e.name == "closed" {
+			return
+		}
+	}
+	t.Fatal("stream ended without a closed event")
+}
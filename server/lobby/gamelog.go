@@ -0,0 +1,37 @@
+package lobby
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// gameLog serves a lobby's game log: plain text, one entry per line, or JSON
+// with ?format=json or an Accept header asking for it. The log is public —
+// it never names a card that went somewhere private — so anyone who knows
+// the lobby id may read it, like joining would let them.
+func (srv *Lobbies) gameLog(w http.ResponseWriter, r *http.Request) {
+	srv.lobbiesMu.RLock()
+	l, ok := srv.lobbies[chi.URLParam(r, "lobby")]
+	srv.lobbiesMu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	entries := l.state.Log()
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"lobby": l.ID, "entries": entries})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, e := range entries {
+		at := time.UnixMilli(e.Timestamp).UTC().Format(time.TimeOnly)
+		fmt.Fprintf(w, "%s %s\n", at, e.Text)
+	}
+}
@@ -0,0 +1,43 @@
+package lobby
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/jollygrin/tts-server/game"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGameLogIsServedAsTextAndJSON(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{})
+	alice := dial(t, ts, "logged", "alice", nil)
+	m := nextMessage(t, alice, "log")
+	require.Contains(t, string(m.Value), "alice joined")
+
+	resp, err := http.Get(ts.URL + "/logged/log")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+	require.Regexp(t, `^\d\d:\d\d:\d\d alice joined\n$`, string(body))
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/logged/log", nil)
+	req.Header.Set("Accept", "application/json")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var got struct {
+		Entries []game.LogEntry `json:"entries"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Len(t, got.Entries, 1)
+	require.Equal(t, "join", got.Entries[0].Kind)
+
+	resp, err = http.Get(ts.URL + "/nowhere/log")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
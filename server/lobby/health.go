@@ -0,0 +1,114 @@
+package lobby
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrDraining refuses new lobbies once the server has started shutting down.
+var ErrDraining = errors.New("server is shutting down")
+
+// readyCheckTimeout bounds each readiness check, so a hung dependency answers
+// "not ready" instead of hanging the probe.
+const readyCheckTimeout = 2 * time.Second
+
+// ReadyCheck is one readiness dependency, such as a persistence store. It
+// returns nil when the dependency is usable.
+type ReadyCheck func(ctx context.Context) error
+
+// checkJSON is one check in a /healthz or /readyz body.
+type checkJSON struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// AddReadyCheck adds a dependency /readyz must see healthy. Call it before
+// serving.
+func (srv *Lobbies) AddReadyCheck(name string, check ReadyCheck) {
+	srv.readyChecks = append(srv.readyChecks, namedCheck{name, check})
+}
+
+type namedCheck struct {
+	name  string
+	check ReadyCheck
+}
+
+// Drain marks the server as going away: /readyz fails so the platform stops
+// routing players here, and no new lobbies are created. Lobbies already
+// running carry on until Shutdown.
+func (srv *Lobbies) Drain() {
+	srv.draining.Store(true)
+}
+
+// Shutdown closes every lobby, telling its clients to reconnect elsewhere, and
+// waits for the close handshakes to finish.
+func (srv *Lobbies) Shutdown() {
+	srv.Drain()
+	srv.lobbiesMu.RLock()
+	ids := make([]string, 0, len(srv.lobbies))
+	for id := range srv.lobbies {
+		ids = append(ids, id)
+	}
+	srv.lobbiesMu.RUnlock()
+	var pending []<-chan struct{}
+	for _, id := range ids {
+		if done, ok := srv.closeLobby(id, ErrDraining.Error()); ok {
+			pending = append(pending, done)
+		}
+	}
+	for _, done := range pending {
+		<-done
+	}
+}
+
+// healthz answers whether the process is alive at all: if this handler runs,
+// it is.
+func (srv *Lobbies) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status": "ok",
+		"checks": []checkJSON{{Name: "process", OK: true}},
+	})
+}
+
+// readyz answers whether this instance should get new players: not draining,
+// room for another lobby, and every ReadyCheck passing. Any failure is a 503.
+func (srv *Lobbies) readyz(w http.ResponseWriter, r *http.Request) {
+	checks := []checkJSON{{Name: "draining", OK: !srv.draining.Load()}}
+	if !checks[0].OK {
+		checks[0].Detail = ErrDraining.Error()
+	}
+
+	srv.lobbiesMu.RLock()
+	lobbies := len(srv.lobbies)
+	srv.lobbiesMu.RUnlock()
+	quota := checkJSON{Name: "lobbies", OK: true, Detail: fmt.Sprintf("%d open", lobbies)}
+	if max := srv.cfg.Quotas.MaxLobbies; max > 0 {
+		quota.OK = lobbies < max
+		quota.Detail = fmt.Sprintf("%d of %d open", lobbies, max)
+	}
+	checks = append(checks, quota)
+
+	for _, c := range srv.readyChecks {
+		ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+		err := c.check(ctx)
+		cancel()
+		result := checkJSON{Name: c.name, OK: err == nil}
+		if err != nil {
+			result.Detail = err.Error()
+		}
+		checks = append(checks, result)
+	}
+
+	status, code := "ok", http.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			status, code = "unavailable", http.StatusServiceUnavailable
+			break
+		}
+	}
+	writeJSON(w, code, map[string]any{"status": status, "checks": checks})
+}
@@ -0,0 +1,81 @@
+package lobby
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/coder/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+type healthBody struct {
+	Status string      `json:"status"`
+	Checks []checkJSON `json:"checks"`
+}
+
+func probe(t *testing.T, url string) (int, healthBody) {
+	t.Helper()
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var body healthBody
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return resp.StatusCode, body
+}
+
+func failing(body healthBody) []string {
+	var names []string
+	for _, c := range body.Checks {
+		if !c.OK {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+func TestReadyzFollowsLobbyQuota(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{MaxLobbies: 1})
+	code, body := probe(t, ts.URL+"/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "ok", body.Status)
+
+	requireOpen(t, dial(t, ts, "only", "alice", nil))
+	code, body = probe(t, ts.URL+"/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, []string{"lobbies"}, failing(body))
+
+	// still alive, just full
+	code, _ = probe(t, ts.URL+"/healthz")
+	require.Equal(t, http.StatusOK, code)
+}
+
+func TestDrainFailsReadinessAndRefusesNewLobbies(t *testing.T) {
+	srv, ts := quotaServer(t, Quotas{})
+	alice := dial(t, ts, "existing", "alice", nil)
+	requireOpen(t, alice)
+
+	srv.Drain()
+	code, body := probe(t, ts.URL+"/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, []string{"draining"}, failing(body))
+
+	requireOpen(t, dial(t, ts, "existing", "bob", nil))
+	requireRefused(t, dial(t, ts, "fresh", "carol", nil), ErrDraining)
+
+	go srv.Shutdown() // waits for alice to answer the close
+	requireClosedWith(t, alice, websocket.StatusGoingAway, ErrDraining.Error())
+}
+
+func TestReadyzRunsReadyChecks(t *testing.T) {
+	srv, ts := quotaServer(t, Quotas{})
+	_, body := probe(t, ts.URL+"/readyz")
+	require.Len(t, body.Checks, 2, "with nothing registered, only draining and lobbies are checked")
+
+	srv.AddReadyCheck("store", func(context.Context) error { return errors.New("connection refused") })
+	code, body := probe(t, ts.URL+"/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Contains(t, body.Checks, checkJSON{Name: "store", OK: false, Detail: "connection refused"})
+}
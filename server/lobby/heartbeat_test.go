@@ -0,0 +1,81 @@
+package lobby
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/jollygrin/tts-server/clock"
+	"github.com/stretchr/testify/require"
+)
+
+// heartbeatServer pings every 10s and waits 1s for the pong, on a fake clock.
+func heartbeatServer(t *testing.T) (*Lobbies, *clock.Fake, *websocket.Conn) {
+	t.Helper()
+	fake := clock.NewFake(time.Unix(0, 0))
+	cfg := testConfig()
+	cfg.Clock = fake
+	cfg.PingInterval = 10 * time.Second
+	cfg.PongTimeout = time.Second
+	srv, ts := testServer(t, cfg)
+
+	alice := dial(t, ts, "beat", "alice", nil)
+	requireOpen(t, alice)
+	// the first ping is scheduled for 10s out
+	waitForTimer(t, fake, 10*time.Second)
+
+	return srv, fake, alice
+}
+
+// waitForTimer waits until the fake clock's next timer is d from now.
+func waitForTimer(t *testing.T, fake *clock.Fake, d time.Duration) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		next, ok := fake.Next()
+		return ok && next.Equal(fake.Now().Add(d))
+	}, 2*time.Second, 5*time.Millisecond)
+}
+
+func connected(srv *Lobbies, lobby string) int {
+	srv.lobbiesMu.RLock()
+	l := srv.lobbies[lobby]
+	srv.lobbiesMu.RUnlock()
+	return l.clientCount()
+}
+
+func TestMissedPongDisconnects(t *testing.T) {
+	srv, fake, _ := heartbeatServer(t)
+	// alice never reads, so the pong for the ping is never processed
+
+	fake.Advance(10 * time.Second)
+	waitForTimer(t, fake, time.Second) // the pong deadline
+	fake.Advance(time.Second)
+
+	require.Eventually(t, func() bool { return connected(srv, "beat") == 0 },
+		2*time.Second, 5*time.Millisecond)
+	l, _ := srv.lobby("beat")
+	require.False(t, l.state.Stats().Players[0].Connected,
+		"the player is marked offline as soon as the socket is dropped")
+}
+
+func TestAnsweredPingKeepsClient(t *testing.T) {
+	srv, fake, alice := heartbeatServer(t)
+	// reading is what processes the pong
+	go func() {
+		for {
+			if _, _, err := alice.Read(context.Background()); err != nil {
+				return
+			}
+		}
+	}()
+
+	for range 3 {
+		fake.Advance(10 * time.Second)
+		// the pong came back: the deadline is gone and the next ping is queued
+		waitForTimer(t, fake, 10*time.Second)
+	}
+	fake.Advance(time.Second)
+	require.Never(t, func() bool { return connected(srv, "beat") == 0 },
+		100*time.Millisecond, 10*time.Millisecond)
+}
@@ -0,0 +1,110 @@
+package lobby
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/jollygrin/tts-server/game"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostBanWithIPClosesAndRefusesAddress(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{})
+	host := dial(t, ts, "ban", "alice", http.Header{"X-Forwarded-For": {"203.0.113.1"}})
+	requireOpen(t, host)
+	bobHeader := http.Header{"X-Forwarded-For": {"203.0.113.2"}}
+	bob := dial(t, ts, "ban", "bob", bobHeader)
+	requireOpen(t, bob)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, wsjson.Write(ctx, host, game.Message{
+		Type:  "ban",
+		Value: []byte(`{"player":"bob","ip":true}`),
+	}))
+	requireClosedWith(t, bob, websocket.StatusPolicyViolation, "banned by host")
+
+	// a new id from the same address is refused too
+	requireClosedWith(t, dial(t, ts, "ban", "bob2", bobHeader), websocket.StatusPolicyViolation, game.ErrBanned.Error())
+	// …but only in this lobby
+	requireOpen(t, dial(t, ts, "elsewhere", "bob", bobHeader))
+}
+
+func TestBanWithIPReachesAnOfflinePlayer(t *testing.T) {
+	srv, ts := quotaServer(t, Quotas{})
+	host := dial(t, ts, "gone", "alice", nil)
+	requireOpen(t, host)
+	bobHeader := http.Header{"X-Forwarded-For": {"203.0.113.2"}}
+	bob := dial(t, ts, "gone", "bob", bobHeader)
+	requireOpen(t, bob)
+	bob.Close(websocket.StatusNormalClosure, "")
+	require.Eventually(t, func() bool { return connected(srv, "gone") == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, wsjson.Write(ctx, host, game.Message{
+		Type:  "ban",
+		Value: []byte(`{"player":"bob","ip":true}`),
+	}))
+	l, _ := srv.lobby("gone")
+	require.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		_, banned := l.bannedIPs["203.0.113.2"]
+		return banned
+	}, 2*time.Second, 10*time.Millisecond, "bob has no socket left; the address they last used is banned")
+	requireClosedWith(t, dial(t, ts, "gone", "bob2", bobHeader), websocket.StatusPolicyViolation, game.ErrBanned.Error())
+}
+
+func TestBanWithIPNeedsATrustedProxy(t *testing.T) {
+	srv, ts := testServer(t, testConfig())
+	host := dial(t, ts, "proxied", "alice", nil)
+	requireOpen(t, host)
+	bob := dial(t, ts, "proxied", "bob", nil)
+	requireOpen(t, bob)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, wsjson.Write(ctx, host, game.Message{
+		Type:  "ban",
+		Value: []byte(`{"player":"bob","ip":true}`),
+	}))
+	requireClosedWith(t, bob, websocket.StatusPolicyViolation, "banned by host")
+
+	// everyone shares the peer address of a proxy nobody configured; banning
+	// it would ban the whole server
+	requireOpen(t, dial(t, ts, "proxied", "carol", nil))
+	l, _ := srv.lobby("proxied")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	require.Empty(t, l.bannedIPs)
+}
+
+func TestAdminKickForm(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{})
+	requireOpen(t, dial(t, ts, "kickform", "alice", nil))
+	bob := dial(t, ts, "kickform", "bob", nil)
+	requireOpen(t, bob)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	form := url.Values{"player": {"bob"}, "action": {"ban"}}
+	post := func(token string) *http.Response {
+		resp, err := client.Post(ts.URL+"/kickform/kick?token="+token, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	require.Equal(t, http.StatusNotFound, post("wrong").StatusCode)
+	resp := post("secret")
+	require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	require.Equal(t, "/view?token=secret", resp.Header.Get("Location"))
+	requireClosedWith(t, bob, websocket.StatusPolicyViolation, "removed by an admin")
+	requireClosedWith(t, dial(t, ts, "kickform", "bob", nil), websocket.StatusPolicyViolation, game.ErrBanned.Error())
+}
@@ -0,0 +1,84 @@
+package lobby
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket/wsjson"
+	"github.com/jollygrin/tts-server/game"
+	"github.com/stretchr/testify/require"
+)
+
+// goroutinesOf returns the stacks of live goroutines running a method of any
+// of the given receivers. Stack traces print pointer arguments, so this tells
+// one lobby's goroutines from those other tests left behind.
+func goroutinesOf(receivers ...any) []string {
+	buf := make([]byte, 1<<22)
+	buf = buf[:runtime.Stack(buf, true)]
+	var found []string
+	for _, g := range strings.Split(string(buf), "\n\n") {
+		for _, r := range receivers {
+			if strings.Contains(g, fmt.Sprintf("(%p", r)) {
+				found = append(found, g)
+				break
+			}
+		}
+	}
+	return found
+}
+
+func requireNoGoroutines(t *testing.T, receivers ...any) {
+	t.Helper()
+	var left []string
+	require.Eventually(t, func() bool {
+		left = goroutinesOf(receivers...)
+		return len(left) == 0
+	}, 2*time.Second, 10*time.Millisecond, "goroutines outlived the lobby:\n%s", strings.Join(left, "\n\n"))
+}
+
+func TestClosedLobbyLeavesNoGoroutines(t *testing.T) {
+	srv, ts := quotaServer(t, Quotas{})
+	alice := dial(t, ts, "leaky", "alice", nil)
+	requireOpen(t, alice)
+	// bob never reads, so nothing answers the server's close
+	dial(t, ts, "leaky", "bob", nil)
+	requireOpen(t, dial(t, ts, "leaky", "carol", nil))
+
+	l, err := srv.lobby("leaky")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return l.clientCount() == 3 }, time.Second, 5*time.Millisecond)
+	require.NotEmpty(t, goroutinesOf(l, srv))
+
+	// a client mid-message when the lobby goes
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, wsjson.Write(ctx, alice, game.Message{Type: "update", Value: []byte(`{"a":1}`)}))
+
+	l.Close()
+	requireNoGoroutines(t, l, l.state, srv)
+	require.Zero(t, l.clientCount())
+}
+
+func TestStuckWriteTimesOut(t *testing.T) {
+	cfg := testConfig()
+	cfg.WriteTimeout = 100 * time.Millisecond
+	cfg.SendBuffer = 1024
+	cfg.Game.Limits.MaxStateBytes = 0
+	srv, ts := testServer(t, cfg)
+	// alice never reads: once the socket buffers fill, writes block
+	dial(t, ts, "stuck", "alice", nil)
+	l, err := srv.lobby("stuck")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return l.clientCount() == 1 }, time.Second, 5*time.Millisecond)
+
+	big := fmt.Sprintf(`{"blob":%q}`, strings.Repeat("x", 1<<20))
+	for i := 0; i < 64 && l.clientCount() > 0; i++ {
+		require.NoError(t, l.state.Patch([]byte(big)))
+	}
+	require.Eventually(t, func() bool { return l.clientCount() == 0 }, 5*time.Second, 10*time.Millisecond,
+		"a write that can't complete must give up and drop the client")
+}
@@ -3,28 +3,35 @@ package lobby
 import (
 	"time"
 
+	"github.com/coder/websocket"
+	"github.com/jollygrin/tts-server/metrics"
 	"github.com/rs/zerolog/log"
 )
 
-// how long an empty lobby survives before it's garbage-collected — long
-// enough that a full-lobby refresh/reconnect doesn't lose the game state
-const emptyLobbyTTL = 15 * time.Minute
-
-func (l *Lobbies) lobby(id string) *Lobby {
+// lobby returns the lobby with this id, creating it unless the server is
+// draining or that would exceed Quotas.MaxLobbies.
+func (l *Lobbies) lobby(id string) (*Lobby, error) {
 	l.lobbiesMu.Lock()
 	defer l.lobbiesMu.Unlock()
 
 	if lobby, exists := l.lobbies[id]; exists {
-		return lobby
+		return lobby, nil
+	}
+	if l.draining.Load() {
+		return nil, ErrDraining
+	}
+	if max := l.cfg.Quotas.MaxLobbies; max > 0 && len(l.lobbies) >= max {
+		l.rejected.lobbies.Add(1)
+		return nil, ErrTooManyLobbies
 	}
 
 	log.Info().
 		Str("lobby", id).
 		Msgf("Creating new lobby: %s", id)
 
-	lobby := newLobby(id)
+	lobby := newLobby(id, l.cfg)
 	lobby.onEmpty = func() {
-		time.AfterFunc(emptyLobbyTTL, func() {
+		time.AfterFunc(l.cfg.EmptyLobbyTTL, func() {
 			l.lobbiesMu.Lock()
 			defer l.lobbiesMu.Unlock()
 			existing, ok := l.lobbies[id]
@@ -34,9 +41,33 @@ func (l *Lobbies) lobby(id string) *Lobby {
 			log.Info().Str("lobby", id).Msg("Removing idle empty lobby")
 			delete(l.lobbies, id)
 			lobby.Close()
+			metrics.LobbiesCollected.Inc()
 		})
 	}
 
 	l.lobbies[id] = lobby
-	return lobby
+	return lobby, nil
+}
+
+// closeLobby drops a lobby immediately: the next connect to the same id
+// starts a fresh lobby. Its sockets are closed with reason in the background,
+// since close handshakes can take seconds; done is closed once they have
+// finished and the lobby has stopped. ok reports whether the lobby existed.
+func (l *Lobbies) closeLobby(id, reason string) (done <-chan struct{}, ok bool) {
+	l.lobbiesMu.Lock()
+	lobby, ok := l.lobbies[id]
+	delete(l.lobbies, id)
+	l.lobbiesMu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	log.Info().Str("lobby", id).Msg("Closing lobby: " + reason)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		lobby.closeClients(websocket.StatusGoingAway, reason)
+		lobby.Close()
+	}()
+	return closed, true
 }
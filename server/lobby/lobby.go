@@ -4,8 +4,10 @@ import (
 	"context"
 	"slices"
 	"sync"
+	"time"
 
 	"github.com/jollygrin/tts-server/game"
+	"github.com/jollygrin/tts-server/metrics"
 	"github.com/rs/zerolog/log"
 
 	"github.com/coder/websocket"
@@ -22,22 +24,36 @@ type Lobby struct {
 	state      *game.Game
 	gameEvents <-chan *game.PlayerMessage
 	mu         sync.Mutex
-	cancel     context.CancelFunc
+	// canceled by Close; every client's context derives from it
+	ctx    context.Context
+	cancel context.CancelFunc
+	cfg    Config
+	// source addresses banned for the lobby's lifetime (see game.KickOptions)
+	bannedIPs map[string]struct{}
+	// the address each player id last connected from, so a ban by address
+	// reaches players who are offline when it's made
+	lastIPs map[string]string
 	// called (outside l.mu) whenever the last client leaves — used by Lobbies
 	// to garbage-collect idle lobbies
 	onEmpty func()
 }
 
-func newLobby(id string) *Lobby {
+func newLobby(id string, cfg Config) *Lobby {
 	ctx, cancel := context.WithCancel(context.Background())
-	g, msgs := game.NewGame()
+	gcfg := cfg.Game
+	gcfg.Clock = cfg.Clock
+	g, msgs := game.NewGame(gcfg)
 	l := &Lobby{
 		ID:         id,
 		clients:    make(map[*Client]struct{}),
 		state:      g,
 		gameEvents: msgs,
 		mu:         sync.Mutex{},
+		ctx:        ctx,
 		cancel:     cancel,
+		cfg:        cfg,
+		bannedIPs:  make(map[string]struct{}),
+		lastIPs:    make(map[string]string),
 	}
 
 	go l.run(ctx)
@@ -46,6 +62,8 @@ func newLobby(id string) *Lobby {
 
 func (l *Lobby) run(ctx context.Context) {
 	defer l.Close()
+	stalls := time.NewTicker(l.cfg.StallTimeout / 4)
+	defer stalls.Stop()
 	for {
 		select {
 		case <-ctx.Done():
@@ -53,15 +71,43 @@ func (l *Lobby) run(ctx context.Context) {
 				Str("lobby", l.ID).
 				Msg("Lobby closing")
 			return
+		case now := <-stalls.C:
+			l.checkDirty(now)
 		case msg := <-l.gameEvents:
 			l.mu.Lock()
+			if msg.Close != "" && msg.BanIP {
+				for _, id := range msg.To {
+					if ip := l.lastIPs[id]; ip != "" {
+						l.bannedIPs[ip] = struct{}{}
+					}
+				}
+			}
 			for client := range l.clients {
 				if msg.Exclude != client.Player.ID && (len(msg.To) == 0 || slices.Contains(msg.To, client.ID)) {
+					if msg.Close != "" {
+						if msg.BanIP && client.IP != "" {
+							l.bannedIPs[client.IP] = struct{}{}
+						}
+						// Close waits for the close handshake — never under l.mu
+						go func(c *Client, reason string) {
+							_ = c.Conn.Close(websocket.StatusPolicyViolation, reason)
+						}(client, msg.Close)
+						continue
+					}
 					select {
 					case client.Send <- msg.Content:
+						metrics.MessagesOut.WithLabelValues(metrics.TypeLabel(msg.Type)).Inc()
+						if msg.Type == "sync" {
+							// a full state supersedes whatever was missed
+							client.dirtySince, client.resyncing = time.Time{}, false
+						}
 					default:
+						metrics.Dropped.WithLabelValues(metrics.DropSendBufferFull).Inc()
+						l.state.Events().Publish(game.Event{Kind: game.EventDropped, Type: msg.Type, Player: client.ID})
 						// slow consumer with a full buffer: dropping beats
-						// blocking the whole lobby on one stalled client
+						// blocking the whole lobby on one stalled client, and
+						// checkDirty re-syncs it once it catches up
+						l.markDirtyLocked(client, time.Now())
 						log.Warn().
 							Str("lobby", l.ID).
 							Str("player", client.ID).
@@ -74,49 +120,146 @@ func (l *Lobby) run(ctx context.Context) {
 	}
 }
 
+// markDirtyLocked records that c missed a message. Caller must hold l.mu.
+func (l *Lobby) markDirtyLocked(c *Client, now time.Time) {
+	if c.dirtySince.IsZero() {
+		c.dirtySince = now
+	}
+	// a sync already on its way may be the message that was dropped
+	c.resyncing = false
+}
+
+// checkDirty deals with clients that missed messages: once a client's send
+// buffer has drained it gets a fresh sync; if it's still behind after
+// StallTimeout it's disconnected, and its reconnect syncs it instead.
+func (l *Lobby) checkDirty(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	everyone := l.state.TakeDropped()
+	for c := range l.clients {
+		if everyone {
+			l.markDirtyLocked(c, now)
+		}
+		if c.dirtySince.IsZero() || c.resyncing {
+			continue
+		}
+		if len(c.Send) == 0 {
+			c.resyncing = true
+			metrics.Resyncs.Inc()
+			l.state.Events().Publish(game.Event{Kind: game.EventResync, Player: c.ID})
+			log.Info().Str("lobby", l.ID).Str("player", c.ID).Msg("Re-syncing client that missed messages")
+			// the sync comes back through l.gameEvents, which this goroutine drains
+			go l.state.SyncPlayerState(c.ID)
+			continue
+		}
+		if now.Sub(c.dirtySince) >= l.cfg.StallTimeout {
+			c.dirtySince = time.Time{}
+			metrics.StallDisconnects.Inc()
+			l.state.Events().Publish(game.Event{Kind: game.EventStalled, Player: c.ID})
+			log.Warn().Str("lobby", l.ID).Str("player", c.ID).Msg("Disconnecting stalled client")
+			go func(c *Client) {
+				_ = c.Conn.Close(websocket.StatusTryAgainLater, "connection too slow, reconnect to catch up")
+			}(c)
+		}
+	}
+}
+
+// Close stops the lobby. Canceling its context unblocks every client's reads
+// and writes, so their goroutines unsubscribe and exit.
 func (l *Lobby) Close() {
 	l.cancel()
-	// TODO: CLOSE GAME
-	// WATCH CHANNELS, prevent deadlocks and leaks
+	l.state.Events().Close()
+	l.state.Close()
 }
 
-func (l *Lobby) AddClient(id string, conn *websocket.Conn) *Client {
-	// Enter the player into the game first
-	player := l.state.ConnectPlayer(id)
+// closeClients closes every socket in the lobby and waits for the close
+// handshakes, so the reason reaches clients before a Close cancels their
+// contexts. Each socket's reader then unsubscribes it as usual.
+func (l *Lobby) closeClients(status websocket.StatusCode, reason string) {
+	l.mu.Lock()
+	clients := make([]*Client, 0, len(l.clients))
+	for c := range l.clients {
+		clients = append(clients, c)
+	}
+	l.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range clients {
+		// Close waits for the close handshake — one slow peer mustn't hold up the rest
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			_ = c.Conn.Close(status, reason)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// AddClient enters a socket from address ip into the lobby, for player id
+// with the secret they were issued (empty on a first join). It fails with
+// game.ErrBanned for a banned address, ErrTooManyClients past the lobby's
+// socket cap, or with the game's error (game.ErrLobbyFull, game.ErrBanned,
+// game.ErrWrongSecret) when the player can't join.
+func (l *Lobby) AddClient(id, secret, ip string, conn *websocket.Conn, role game.Role) (*Client, error) {
+	l.mu.Lock()
+	_, banned := l.bannedIPs[ip]
+	max := l.cfg.Quotas.MaxClientsPerLobby
+	full := max > 0 && len(l.clients) >= max
+	l.mu.Unlock()
+	if banned {
+		return nil, game.ErrBanned
+	}
+	if full {
+		return nil, ErrTooManyClients
+	}
+
+	// Enter the player into the game first, outside l.mu: the game's sends
+	// are drained by run, which takes l.mu for each one
+	player, err := l.state.ConnectPlayer(id, secret, role)
+	if err != nil {
+		return nil, err
+	}
 
 	// TODO: Excessive locking
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	if ip != "" {
+		l.lastIPs[id] = ip
+	}
 
 	// Create a rate limiter using leaky bucket strategy.
 	// Each message from a client costs 1 token.
 	// Each client is given a bucket of tokens to spend from. The size of
-	// the bucket is {messageBucket}. They are given {messageRate} tokens per
+	// the bucket is {MessageBurst}. They are given {MessageRate} tokens per
 	// second to refill their bucket as they use it.
 	//
-	// In simple terms, a client can send {messageRate} msgs/s with a burst of up to {messageBucket}
+	// In simple terms, a client can send {MessageRate} msgs/s with a burst of up to {MessageBurst}
 	// Extremely aggressive rate limiting to disconnect users sending sustained messages
-	messageRate := rate.Limit(7) // per second (only 1 message every 2 seconds on average)
-	messageBucket := 15          // minimal burst capacity (disconnect after just X rapid messages)
-	rateLimiter := rate.NewLimiter(messageRate, messageBucket)
+	rateLimiter := rate.NewLimiter(rate.Limit(l.cfg.MessageRate), l.cfg.MessageBurst)
 
+	ctx, cancel := context.WithCancel(l.ctx)
 	client := &Client{
 		ID:          id,
+		IP:          ip,
 		Conn:        conn,
-		Send:        make(chan []byte, 256),
+		Send:        make(chan []byte, l.cfg.SendBuffer),
 		Player:      player,
 		RateLimiter: rateLimiter,
+		ctx:         ctx,
+		cancel:      cancel,
 	}
 
 	// Add to the lobby
 	l.clients[client] = struct{}{}
 
-	return client
+	return client, nil
 }
 
 // Client represents a websocket client
 type Client struct {
 	ID string
+	// source address, as counted by the per-IP quota
+	IP string
 	// TODO: Refactor to a more general conn or use channels
 	Conn *websocket.Conn
 	Send chan []byte // TODO: Statically type this message
@@ -126,41 +269,64 @@ type Client struct {
 	RateLimiter *rate.Limiter
 
 	close sync.Once
+	// derived from the lobby's context; canceled on unsubscribe or when the
+	// lobby closes, ending the client's goroutines
+	ctx    context.Context
+	cancel context.CancelFunc
+	// when the client first missed a message since its last sync, zero when
+	// it's up to date; resyncing while a sync is on its way (see checkDirty).
+	// Both guarded by the lobby's mu.
+	dirtySince time.Time
+	resyncing  bool
+	// frees the per-IP connection slot; called once, on unsubscribe
+	release func()
 }
 
-func (l *Lobby) clientRead(ctx context.Context, c *Client) {
+func (l *Lobby) clientRead(c *Client) {
 	defer l.unsubscribe(c)
 	for {
 		// Read message from client
 		var msg game.Message
-		err := wsjson.Read(ctx, c.Conn, &msg)
+		err := wsjson.Read(c.ctx, c.Conn, &msg)
 		if err != nil {
 			break
 		}
 
 		if !c.RateLimiter.Allow() {
+			metrics.RateLimitDisconnects.Inc()
+			l.state.Events().Publish(game.Event{Kind: game.EventRateLimit, Type: msg.Type, Player: c.ID})
 			log.Error().Str("player", c.ID).Msg("Rate limit exceeded, disconnecting player")
 			_ = c.Conn.Close(websocket.StatusPolicyViolation, "rate limit exceeded")
 			l.unsubscribe(c)
 			break
 		}
 
+		metrics.MessagesIn.WithLabelValues(metrics.TypeLabel(msg.Type)).Inc()
+		l.state.Events().Publish(game.Event{Kind: game.EventInbound, Type: msg.Type, Player: c.ID, Value: msg.Value})
 		l.state.HandleMessage(c.Player, msg)
 	}
 }
 
-func (l *Lobby) clientWrite(ctx context.Context, c *Client) {
+// clientWrite sends c's queued messages. Each write gets WriteTimeout: a
+// socket that stops accepting data fails the write instead of blocking this
+// goroutine forever.
+func (l *Lobby) clientWrite(c *Client) {
 	defer l.unsubscribe(c)
 	for {
 		select {
+		case <-c.ctx.Done():
+			return
 		case message, ok := <-c.Send:
 			if !ok {
 				// Channel was closed
 				return
 			}
 
-			if err := c.Conn.Write(context.Background(), websocket.MessageText, message); err != nil {
-				log.Err(err).Msg("Failed to write message")
+			ctx, cancel := context.WithTimeout(c.ctx, l.cfg.WriteTimeout)
+			err := c.Conn.Write(ctx, websocket.MessageText, message)
+			cancel()
+			if err != nil {
+				log.Err(err).Str("player", c.ID).Msg("Failed to write message")
 				return
 			}
 
@@ -171,12 +337,46 @@ func (l *Lobby) clientWrite(ctx context.Context, c *Client) {
 	}
 }
 
+// clientPing pings c every PingInterval until it unsubscribes. A client that
+// doesn't pong within PongTimeout is dropped at once — no close handshake, its
+// connection is presumed dead — and clientRead's unsubscribe starts the
+// player's offline grace period.
+func (l *Lobby) clientPing(c *Client) {
+	for {
+		tick := make(chan struct{})
+		t := l.cfg.Clock.AfterFunc(l.cfg.PingInterval, func() { close(tick) })
+		select {
+		case <-c.ctx.Done():
+			t.Stop()
+			return
+		case <-tick:
+		}
+
+		// Ping returns once the pong arrives; clientRead's reads deliver it
+		ctx, cancel := context.WithCancel(c.ctx)
+		deadline := l.cfg.Clock.AfterFunc(l.cfg.PongTimeout, cancel)
+		err := c.Conn.Ping(ctx)
+		deadline.Stop()
+		cancel()
+		if err == nil {
+			continue
+		}
+		if c.ctx.Err() != nil {
+			return // closed from our side meanwhile
+		}
+		metrics.HeartbeatTimeouts.Inc()
+		l.state.Events().Publish(game.Event{Kind: game.EventHeartbeat, Player: c.ID})
+		log.Warn().Str("lobby", l.ID).Str("player", c.ID).Msg("Client missed a heartbeat, disconnecting")
+		_ = c.Conn.CloseNow()
+		return
+	}
+}
+
 // unsubscribe will only close the connection once
 func (l *Lobby) unsubscribe(c *Client) {
 	c.close.Do(func() {
 		l.mu.Lock()
 		l.state.DisconnectPlayer(c.Player)
-		_ = c.Conn.Close(websocket.StatusInternalError, "unsubscribing")
 		delete(l.clients, c)
 		// safe: run() only sends to clients still in the map, under this same
 		// lock — closing lets the clientWrite goroutine exit instead of leaking
@@ -184,6 +384,16 @@ func (l *Lobby) unsubscribe(c *Client) {
 		empty := len(l.clients) == 0
 		l.mu.Unlock()
 
+		// the close handshake can take seconds on a dead socket — not under l.mu
+		_ = c.Conn.Close(websocket.StatusInternalError, "unsubscribing")
+		if c.cancel != nil {
+			c.cancel()
+		}
+
+		if c.release != nil {
+			c.release()
+		}
+
 		if empty && l.onEmpty != nil {
 			l.onEmpty()
 		}
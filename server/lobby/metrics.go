@@ -0,0 +1,74 @@
+package lobby
+
+import (
+	"net/http"
+
+	"github.com/jollygrin/tts-server/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	lobbiesDesc = prometheus.NewDesc("tts_lobbies", "Lobbies currently open.", nil, nil)
+	clientsDesc = prometheus.NewDesc("tts_clients", "Client sockets currently connected.", nil, nil)
+	stateDesc   = prometheus.NewDesc("tts_lobby_state_bytes", "Encoded size of a lobby's table state.", []string{"lobby"}, nil)
+)
+
+// lobbyCollector reports the live lobbies at scrape time, so the gauges can't
+// drift from the lobby map they describe.
+type lobbyCollector struct {
+	srv *Lobbies
+}
+
+func (c lobbyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lobbiesDesc
+	ch <- clientsDesc
+	ch <- stateDesc
+}
+
+func (c lobbyCollector) Collect(ch chan<- prometheus.Metric) {
+	// copy lobby refs under the map lock, gather stats after releasing it
+	c.srv.lobbiesMu.RLock()
+	lobbies := make([]*Lobby, 0, len(c.srv.lobbies))
+	for _, l := range c.srv.lobbies {
+		lobbies = append(lobbies, l)
+	}
+	c.srv.lobbiesMu.RUnlock()
+
+	clients := 0
+	for _, l := range lobbies {
+		clients += l.clientCount()
+		ch <- prometheus.MustNewConstMetric(stateDesc, prometheus.GaugeValue, float64(l.state.Stats().StateBytes), l.ID)
+	}
+	ch <- prometheus.MustNewConstMetric(lobbiesDesc, prometheus.GaugeValue, float64(len(lobbies)))
+	ch <- prometheus.MustNewConstMetric(clientsDesc, prometheus.GaugeValue, float64(clients))
+}
+
+// newRegistry collects this server's lobbies plus the process-wide metrics
+// and the Go runtime. A registry per server keeps tests from colliding.
+func newRegistry(srv *Lobbies) *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		lobbyCollector{srv},
+	)
+	reg.MustRegister(metrics.Collectors()...)
+	return reg
+}
+
+// MetricsHandler serves /metrics without any auth — for a separate bind
+// address that only the scraper can reach. The main router serves the same
+// page behind the admin token.
+func (srv *Lobbies) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(srv.registry, promhttp.HandlerOpts{})
+}
+
+func (srv *Lobbies) metrics(w http.ResponseWriter, r *http.Request) {
+	if !srv.isAdmin(r) {
+		http.NotFound(w, r)
+		return
+	}
+	srv.MetricsHandler().ServeHTTP(w, r)
+}
@@ -0,0 +1,58 @@
+package lobby
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket/wsjson"
+	"github.com/jollygrin/tts-server/game"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T, url string) (int, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{})
+
+	code, _ := scrape(t, ts.URL+"/metrics")
+	require.Equal(t, http.StatusNotFound, code, "metrics are admin-only on the public router")
+
+	conn := dial(t, ts, "metrics", "alice", nil)
+	requireOpen(t, conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, wsjson.Write(ctx, conn, game.Message{Type: "update", Value: []byte(`{"cards":{"c1":{}}}`)}))
+	require.NoError(t, wsjson.Write(ctx, conn, game.Message{Type: "made-up-type"}))
+
+	require.Eventually(t, func() bool {
+		_, body := scrape(t, ts.URL+"/metrics?token=secret")
+		return strings.Contains(body, `tts_messages_in_total{type="update"}`) &&
+			strings.Contains(body, `tts_messages_in_total{type="other"}`)
+	}, 2*time.Second, 20*time.Millisecond)
+
+	code, body := scrape(t, ts.URL+"/metrics?token=secret")
+	require.Equal(t, http.StatusOK, code)
+	for _, want := range []string{
+		"tts_lobbies 1",
+		"tts_clients 1",
+		`tts_lobby_state_bytes{lobby="metrics"}`,
+		`tts_messages_out_total{type="sync"}`,
+		"tts_merge_duration_seconds_count",
+		"go_goroutines",
+	} {
+		require.Contains(t, body, want)
+	}
+	require.NotContains(t, body, "made-up-type", "client-chosen types must not become label values")
+}
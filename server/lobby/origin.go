@@ -0,0 +1,12 @@
+package lobby
+
+// defaultOriginPatterns are the sites whose pages may open sockets unless
+// Config.Origins says otherwise: the GitHub Pages build, table.place and its
+// subdomains, and any local dev server port.
+var defaultOriginPatterns = []string{
+	"jollygrin.github.io",
+	"table.place",
+	"*.table.place",
+	"localhost:*",
+	"127.0.0.1:*",
+}
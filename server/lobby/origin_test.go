@@ -0,0 +1,85 @@
+package lobby
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func dialWithOrigin(t *testing.T, ts *httptest.Server, origin string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	header := http.Header{}
+	if origin != "" {
+		header.Set("Origin", origin)
+	}
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?lobby=origins&player=p1"
+	return websocket.Dial(ctx, url, &websocket.DialOptions{HTTPHeader: header})
+}
+
+func TestWebsocketOriginAllowList(t *testing.T) {
+	_, ts := testServer(t, DefaultConfig())
+
+	cases := []struct {
+		origin string
+		allow  bool
+	}{
+		{"https://jollygrin.github.io", true},
+		{"https://table.place", true},
+		{"https://www.table.place", true},
+		{"https://TABLE.place", true},
+		{"http://localhost:5173", true},
+		{"http://localhost:4173", true},
+		{"http://127.0.0.1:5173", true},
+		{"", true}, // non-browser clients send no Origin
+		{"https://evil.example", false},
+		{"https://table.place.evil.example", false},
+		{"https://eviltable.place", false},
+		{"https://someone.github.io", false},
+		{"http://localhost", false},
+		{"null", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.origin, func(t *testing.T) {
+			conn, resp, err := dialWithOrigin(t, ts, tc.origin)
+			if tc.allow {
+				require.NoError(t, err)
+				conn.Close(websocket.StatusNormalClosure, "")
+				return
+			}
+			require.Error(t, err)
+			require.NotNil(t, resp)
+			require.Equal(t, http.StatusForbidden, resp.StatusCode)
+		})
+	}
+}
+
+func TestWebsocketOriginsFromConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Origins = []string{"staging.example.com", "*.preview.example.com"}
+	_, ts := testServer(t, cfg)
+
+	conn, _, err := dialWithOrigin(t, ts, "https://pr-12.preview.example.com")
+	require.NoError(t, err)
+	conn.Close(websocket.StatusNormalClosure, "")
+
+	// the configured list replaces the defaults rather than adding to them
+	_, resp, err := dialWithOrigin(t, ts, "https://table.place")
+	require.Error(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestConfigRejectsBadOrigins(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Origins = []string{"*", "[bad"}
+	err := cfg.Validate()
+	require.ErrorContains(t, err, `"*" is not supported`)
+	require.ErrorContains(t, err, `malformed allowed origin "[bad"`)
+}
@@ -0,0 +1,154 @@
+package lobby
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// Quotas caps what one server will hold, so a single script can't exhaust
+// the box. Zero means unlimited.
+type Quotas struct {
+	MaxLobbies         int
+	MaxClientsPerLobby int
+	MaxConnsPerIP      int
+}
+
+// DefaultQuotas are generous for real tables and still stop a runaway script.
+var DefaultQuotas = Quotas{
+	MaxLobbies:         500,
+	MaxClientsPerLobby: 32,
+	MaxConnsPerIP:      20,
+}
+
+var (
+	ErrTooManyLobbies = errors.New("server is full: too many lobbies")
+	ErrTooManyClients = errors.New("lobby is full: too many connections")
+	ErrTooManyConns   = errors.New("too many connections from your address")
+)
+
+// QuotaStats counts connections refused by each server-wide quota. Per-game
+// rejections live in game.Stats.
+type QuotaStats struct {
+	Lobbies    int64 `json:"lobbies"`
+	Clients    int64 `json:"clients"`
+	ConnsPerIP int64 `json:"connsPerIP"`
+}
+
+type quotaCounters struct {
+	lobbies    atomic.Int64
+	clients    atomic.Int64
+	connsPerIP atomic.Int64
+}
+
+func (srv *Lobbies) QuotaStats() QuotaStats {
+	return QuotaStats{
+		Lobbies:    srv.rejected.lobbies.Load(),
+		Clients:    srv.rejected.clients.Load(),
+		ConnsPerIP: srv.rejected.connsPerIP.Load(),
+	}
+}
+
+// acquireIP reserves a socket slot for ip, refusing past MaxConnsPerIP. Every
+// successful call must be paired with releaseIP. A socket with no address
+// (see clientIP) is not counted.
+func (srv *Lobbies) acquireIP(ip string) error {
+	if ip == "" {
+		return nil
+	}
+	srv.ipConnsMu.Lock()
+	defer srv.ipConnsMu.Unlock()
+	if max := srv.cfg.Quotas.MaxConnsPerIP; max > 0 && srv.ipConns[ip] >= max {
+		srv.rejected.connsPerIP.Add(1)
+		return ErrTooManyConns
+	}
+	srv.ipConns[ip]++
+	return nil
+}
+
+func (srv *Lobbies) releaseIP(ip string) {
+	if ip == "" {
+		return
+	}
+	srv.ipConnsMu.Lock()
+	defer srv.ipConnsMu.Unlock()
+	if srv.ipConns[ip]--; srv.ipConns[ip] <= 0 {
+		delete(srv.ipConns, ip)
+	}
+}
+
+// clientIP is the address a socket is counted against and banned by: the
+// peer's, unless the peer is one of Config.TrustedProxies. A proxy appends
+// the address it saw to X-Forwarded-For, so from a trusted peer the header is
+// read right to left, past any further trusted hops, to the first address a
+// proxy of ours vouches for. Everything left of that is the client's to
+// forge.
+//
+// With no TrustedProxies it is "", and sockets are neither counted nor banned
+// by address: behind a proxy nobody told us about, every peer is the proxy,
+// and one address would stand for the whole server.
+func (srv *Lobbies) clientIP(r *http.Request) string {
+	if len(srv.proxies) == 0 {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !srv.trusted(host) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			break
+		}
+		if !srv.trusted(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+// trusted reports whether ip is one of Config.TrustedProxies.
+func (srv *Lobbies) trusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range srv.proxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProxies reads Config.TrustedProxies: CIDRs, or bare addresses for a
+// single host.
+func parseProxies(entries []string) ([]netip.Prefix, error) {
+	var (
+		prefixes []netip.Prefix
+		errs     []error
+	)
+	for _, e := range entries {
+		p, err := netip.ParsePrefix(e)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(e)
+			if aerr != nil {
+				errs = append(errs, fmt.Errorf("malformed trusted proxy %q: want a CIDR or an address", e))
+				continue
+			}
+			p = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, errors.Join(errs...)
+}
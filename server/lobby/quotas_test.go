@@ -0,0 +1,179 @@
+package lobby
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/jollygrin/tts-server/game"
+	"github.com/stretchr/testify/require"
+)
+
+// testConfig is DefaultConfig with the admin token "secret".
+func testConfig() Config {
+	cfg := DefaultConfig()
+	cfg.AdminToken = "secret"
+	return cfg
+}
+
+func testServer(t *testing.T, cfg Config) (*Lobbies, *httptest.Server) {
+	t.Helper()
+	require.NoError(t, cfg.Validate())
+	srv := New(cfg)
+	ts := httptest.NewServer(srv.Router())
+	t.Cleanup(ts.Close)
+	return srv, ts
+}
+
+// quotaServer is a server with quotas q that trusts loopback as its proxy,
+// so tests can dial from any address with an X-Forwarded-For header.
+func quotaServer(t *testing.T, q Quotas) (*Lobbies, *httptest.Server) {
+	t.Helper()
+	cfg := testConfig()
+	cfg.Quotas = q
+	cfg.TrustedProxies = []string{"127.0.0.0/8", "::1"}
+	return testServer(t, cfg)
+}
+
+func dial(t *testing.T, ts *httptest.Server, lobby, player string, header http.Header) *websocket.Conn {
+	t.Helper()
+	return dialWithSecret(t, ts, lobby, player, "", header)
+}
+
+// dialWithSecret joins as player, presenting secret in the connect message
+// every socket opens with.
+func dialWithSecret(t *testing.T, ts *httptest.Server, lobby, player, secret string, header http.Header) *websocket.Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?lobby=" + lobby + "&player=" + player
+	conn, _, err := websocket.Dial(ctx, url, &websocket.DialOptions{HTTPHeader: header})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.CloseNow() })
+	value, _ := json.Marshal(map[string]string{"secret": secret})
+	require.NoError(t, wsjson.Write(ctx, conn, game.Message{Type: "connect", PlayerID: player, Value: value}))
+	return conn
+}
+
+// requireRefused checks the socket was closed for a quota, with its reason.
+func requireRefused(t *testing.T, conn *websocket.Conn, want error) {
+	t.Helper()
+	requireClosedWith(t, conn, websocket.StatusTryAgainLater, want.Error())
+}
+
+// requireClosedWith reads until the server closes the socket and checks the
+// close code and reason.
+func requireClosedWith(t *testing.T, conn *websocket.Conn, code websocket.StatusCode, reason string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for {
+		_, _, err := conn.Read(ctx)
+		if err == nil {
+			continue
+		}
+		var ce websocket.CloseError
+		require.True(t, errors.As(err, &ce), "expected a close frame, got %v", err)
+		require.Equal(t, code, ce.Code)
+		require.Equal(t, reason, ce.Reason)
+		return
+	}
+}
+
+// requireOpen checks the server keeps talking to the socket: every joiner is
+// sent a sync.
+func requireOpen(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, _, err := conn.Read(ctx)
+	require.NoError(t, err)
+}
+
+func TestMaxLobbies(t *testing.T) {
+	srv, ts := quotaServer(t, Quotas{MaxLobbies: 1})
+	requireOpen(t, dial(t, ts, "one", "alice", nil))
+	requireRefused(t, dial(t, ts, "two", "bob", nil), ErrTooManyLobbies)
+	// joining the lobby that exists is still fine
+	requireOpen(t, dial(t, ts, "one", "bob", nil))
+	require.Equal(t, int64(1), srv.QuotaStats().Lobbies)
+}
+
+func TestMaxClientsPerLobby(t *testing.T) {
+	srv, ts := quotaServer(t, Quotas{MaxClientsPerLobby: 1})
+	requireOpen(t, dial(t, ts, "full", "alice", nil))
+	requireRefused(t, dial(t, ts, "full", "bob", nil), ErrTooManyClients)
+	require.Equal(t, int64(1), srv.QuotaStats().Clients)
+}
+
+func TestMaxPlayersPerLobby(t *testing.T) {
+	cfg := testConfig()
+	cfg.Game.Limits.MaxPlayers = 1
+	_, ts := testServer(t, cfg)
+	requireOpen(t, dial(t, ts, "duel", "alice", nil))
+	requireRefused(t, dial(t, ts, "duel", "bob", nil), game.ErrLobbyFull)
+}
+
+func TestMaxConnsPerIPIsReleasedOnDisconnect(t *testing.T) {
+	srv, ts := quotaServer(t, Quotas{MaxConnsPerIP: 1})
+	header := http.Header{"X-Forwarded-For": {"203.0.113.7"}}
+
+	first := dial(t, ts, "ip", "alice", header)
+	requireOpen(t, first)
+	requireRefused(t, dial(t, ts, "ip", "bob", header), ErrTooManyConns)
+	// a different address is counted separately
+	requireOpen(t, dial(t, ts, "ip", "carol", http.Header{"X-Forwarded-For": {"203.0.113.8"}}))
+	require.Equal(t, int64(1), srv.QuotaStats().ConnsPerIP)
+
+	first.Close(websocket.StatusNormalClosure, "")
+	require.Eventually(t, func() bool {
+		srv.ipConnsMu.Lock()
+		defer srv.ipConnsMu.Unlock()
+		return srv.ipConns["203.0.113.7"] == 0
+	}, 2*time.Second, 10*time.Millisecond)
+	requireOpen(t, dial(t, ts, "ip", "bob", header))
+}
+
+func TestNoTrustedProxyMeansNoAddressQuota(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.RemoteAddr = "198.51.100.9:5555"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	require.Empty(t, New(testConfig()).clientIP(r), "the peer may be a proxy nobody configured")
+
+	// end to end: every socket comes from the same peer, and none is refused
+	cfg := testConfig()
+	cfg.Quotas = Quotas{MaxConnsPerIP: 1}
+	srv, ts := testServer(t, cfg)
+	requireOpen(t, dial(t, ts, "ip", "alice", nil))
+	requireOpen(t, dial(t, ts, "ip", "bob", nil))
+	require.Zero(t, srv.QuotaStats().ConnsPerIP)
+}
+
+func TestClientIPTakesTheHopATrustedProxyAdded(t *testing.T) {
+	cfg := testConfig()
+	cfg.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1"}
+	srv := New(cfg)
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r.RemoteAddr = "10.0.0.1:5555"
+	require.Equal(t, "10.0.0.1", srv.clientIP(r), "no header: the proxy itself")
+
+	// the client can prepend anything; the proxies' own entries are the last
+	r.Header.Set("X-Forwarded-For", "1.2.3.4, 203.0.113.7, 192.0.2.1")
+	require.Equal(t, "203.0.113.7", srv.clientIP(r))
+
+	r.RemoteAddr = "198.51.100.9:5555"
+	require.Equal(t, "198.51.100.9", srv.clientIP(r), "only a trusted peer's header counts")
+}
+
+func TestValidateRejectsMalformedProxies(t *testing.T) {
+	cfg := testConfig()
+	cfg.TrustedProxies = []string{"10.0.0.0/8", "::1", "proxy.internal"}
+	require.ErrorContains(t, cfg.Validate(), `malformed trusted proxy "proxy.internal"`)
+}
@@ -0,0 +1,144 @@
+package lobby
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// pprofRouter serves net/http/pprof under /debug/pprof, for the admin only:
+// `go tool pprof "https://host/debug/pprof/heap?token=…"` works as usual.
+func (srv *Lobbies) pprofRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !srv.isAdmin(r) {
+				http.NotFound(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.HandleFunc("/cmdline", pprof.Cmdline)
+	r.HandleFunc("/profile", pprof.Profile)
+	r.HandleFunc("/symbol", pprof.Symbol)
+	r.HandleFunc("/trace", pprof.Trace)
+	// Index serves the named profiles (heap, goroutine, allocs, …) too
+	r.HandleFunc("/*", pprof.Index)
+	return r
+}
+
+// goroutinesPerClient is what a connected socket costs: its handler plus the
+// read, write and ping loops.
+const goroutinesPerClient = 4
+
+// runtimeJSON is the /admin/runtime summary.
+type runtimeJSON struct {
+	Uptime     string `json:"uptime"`
+	GoVersion  string `json:"goVersion"`
+	Goroutines int    `json:"goroutines"`
+	// what the open lobbies should account for, and the rest; a growing
+	// unattributed count is the first sign of a leak
+	LobbyGoroutines        int                `json:"lobbyGoroutines"`
+	UnattributedGoroutines int                `json:"unattributedGoroutines"`
+	Lobbies                []lobbyRuntimeJSON `json:"lobbies"`
+	Heap                   heapJSON           `json:"heap"`
+	GC                     gcJSON             `json:"gc"`
+}
+
+type lobbyRuntimeJSON struct {
+	ID      string `json:"id"`
+	Clients int    `json:"clients"`
+	// run loop plus goroutinesPerClient per socket
+	Goroutines int `json:"goroutines"`
+}
+
+type heapJSON struct {
+	AllocBytes   uint64 `json:"allocBytes"`
+	InuseBytes   uint64 `json:"inuseBytes"`
+	IdleBytes    uint64 `json:"idleBytes"`
+	ObjectCount  uint64 `json:"objects"`
+	SysBytes     uint64 `json:"sysBytes"`
+	TotalAllocs  uint64 `json:"totalAllocBytes"`
+	NextGCTarget uint64 `json:"nextGCBytes"`
+}
+
+type gcJSON struct {
+	Count      uint32    `json:"count"`
+	Last       time.Time `json:"last"`
+	PauseTotal string    `json:"pauseTotal"`
+	// most recent first, up to 16
+	RecentPauses []string `json:"recentPauses"`
+}
+
+// adminRuntime summarises the process for diagnosing memory and goroutine
+// growth without redeploying.
+func (srv *Lobbies) adminRuntime(w http.ResponseWriter, r *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	srv.lobbiesMu.RLock()
+	lobbies := make([]*Lobby, 0, len(srv.lobbies))
+	for _, l := range srv.lobbies {
+		lobbies = append(lobbies, l)
+	}
+	srv.lobbiesMu.RUnlock()
+
+	out := runtimeJSON{
+		Uptime:     time.Since(srv.started).Round(time.Second).String(),
+		GoVersion:  runtime.Version(),
+		Goroutines: runtime.NumGoroutine(),
+		Lobbies:    make([]lobbyRuntimeJSON, 0, len(lobbies)),
+		Heap: heapJSON{
+			AllocBytes:   m.HeapAlloc,
+			InuseBytes:   m.HeapInuse,
+			IdleBytes:    m.HeapIdle,
+			ObjectCount:  m.HeapObjects,
+			SysBytes:     m.Sys,
+			TotalAllocs:  m.TotalAlloc,
+			NextGCTarget: m.NextGC,
+		},
+		GC: gcJSON{
+			Count:        m.NumGC,
+			PauseTotal:   time.Duration(m.PauseTotalNs).String(),
+			RecentPauses: []string{},
+		},
+	}
+	if m.LastGC > 0 {
+		out.GC.Last = time.Unix(0, int64(m.LastGC))
+	}
+	// PauseNs is a ring buffer; the latest pause sits at (NumGC+255)%256
+	for i := uint32(0); i < 16 && i < m.NumGC; i++ {
+		pause := m.PauseNs[(m.NumGC+255-i)%256]
+		out.GC.RecentPauses = append(out.GC.RecentPauses, time.Duration(pause).String())
+	}
+
+	for _, l := range lobbies {
+		clients := l.clientCount()
+		lr := lobbyRuntimeJSON{ID: l.ID, Clients: clients, Goroutines: 1 + goroutinesPerClient*clients}
+		out.Lobbies = append(out.Lobbies, lr)
+		out.LobbyGoroutines += lr.Goroutines
+	}
+	sort.Slice(out.Lobbies, func(i, j int) bool { return out.Lobbies[i].ID < out.Lobbies[j].ID })
+	out.UnattributedGoroutines = out.Goroutines - out.LobbyGoroutines
+	writeJSON(w, http.StatusOK, out)
+}
+
+// adminGoroutines dumps every goroutine's stack as plain text.
+func (srv *Lobbies) adminGoroutines(w http.ResponseWriter, r *http.Request) {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write(buf)
+}
@@ -0,0 +1,39 @@
+package lobby
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPprofRequiresAdmin(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{})
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/cmdline"} {
+		code, _ := scrape(t, ts.URL+path)
+		require.Equal(t, http.StatusNotFound, code, path)
+		code, _ = scrape(t, ts.URL+path+"?token=secret")
+		require.Equal(t, http.StatusOK, code, path)
+	}
+	_, body := scrape(t, ts.URL+"/debug/pprof/goroutine?debug=2&token=secret")
+	require.Contains(t, body, "goroutine ")
+}
+
+func TestAdminRuntimeSummary(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{})
+	requireOpen(t, dial(t, ts, "busy", "alice", nil))
+	requireOpen(t, dial(t, ts, "busy", "bob", nil))
+
+	require.Equal(t, http.StatusNotFound, adminGet(t, ts.URL+"/admin/runtime", "", nil))
+	var rt runtimeJSON
+	require.Equal(t, http.StatusOK, adminGet(t, ts.URL+"/admin/runtime", "secret", &rt))
+	require.Equal(t, []lobbyRuntimeJSON{{ID: "busy", Clients: 2, Goroutines: 1 + 2*goroutinesPerClient}}, rt.Lobbies)
+	require.Equal(t, rt.Goroutines, rt.LobbyGoroutines+rt.UnattributedGoroutines)
+	require.NotZero(t, rt.Heap.InuseBytes)
+	require.NotEmpty(t, rt.GoVersion)
+
+	code, dump := adminDo(t, http.MethodGet, ts.URL+"/admin/goroutines", "")
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, strings.Contains(dump, "clientRead"), "the dump covers every goroutine")
+}
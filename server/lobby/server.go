@@ -1,16 +1,23 @@
 package lobby
 
 import (
+	"context"
 	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"html/template"
 	"net/http"
-	"os"
+	"net/netip"
+	"net/url"
 	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/coder/websocket/wsjson"
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
 
 	"github.com/coder/websocket"
@@ -20,12 +27,34 @@ import (
 type Lobbies struct {
 	lobbies   map[string]*Lobby
 	lobbiesMu sync.RWMutex
+
+	cfg Config
+	// parsed from cfg.TrustedProxies; see clientIP
+	proxies []netip.Prefix
+
+	rejected  quotaCounters
+	ipConns   map[string]int
+	ipConnsMu sync.Mutex
+
+	registry *prometheus.Registry
+
+	// set by Drain; see readyz
+	draining    atomic.Bool
+	readyChecks []namedCheck
+
+	started time.Time
 }
 
-func New() *Lobbies {
+// New builds a server from cfg, which the caller has validated.
+func New(cfg Config) *Lobbies {
 	srv := &Lobbies{
 		lobbies: make(map[string]*Lobby),
+		cfg:     cfg,
+		ipConns: make(map[string]int),
+		started: time.Now(),
 	}
+	srv.proxies, _ = parseProxies(cfg.TrustedProxies)
+	srv.registry = newRegistry(srv)
 
 	return srv
 }
@@ -37,26 +66,47 @@ func (srv *Lobbies) Router() http.Handler {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
+	mux.Get("/healthz", srv.healthz)
+	mux.Get("/readyz", srv.readyz)
 	mux.HandleFunc("/view", srv.view)
+	mux.HandleFunc("/metrics", srv.metrics)
 	mux.HandleFunc("/{lobby}/debug", srv.debug)
+	mux.Get("/{lobby}/log", srv.gameLog)
+	mux.Post("/{lobby}/kick", srv.kick)
+	mux.Mount("/admin", srv.adminRouter())
+	mux.Mount("/debug/pprof", srv.pprofRouter())
 	mux.HandleFunc("/ws", srv.handleWebsocket)
 
 	return mux
 }
 
-// isAdmin gates admin pages behind the ADMIN_TOKEN env var: unset = the pages
-// don't exist; set = require ?token=<value> (constant-time compare).
-func isAdmin(r *http.Request) bool {
-	token := os.Getenv("ADMIN_TOKEN")
+// isAdmin gates admin pages behind Config.AdminToken: unset = the pages don't
+// exist; set = require ?token=<value> or an Authorization: Bearer header
+// (constant-time compare).
+func (srv *Lobbies) isAdmin(r *http.Request) bool {
+	if srv.bearerAdmin(r) {
+		return true
+	}
+	return srv.tokenMatches(r.URL.Query().Get("token"))
+}
+
+// bearerAdmin is isAdmin for the JSON API, which only takes the header — a
+// token in the URL ends up in access logs and browser history.
+func (srv *Lobbies) bearerAdmin(r *http.Request) bool {
+	provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && srv.tokenMatches(provided)
+}
+
+func (srv *Lobbies) tokenMatches(provided string) bool {
+	token := srv.cfg.AdminToken
 	if token == "" {
 		return false
 	}
-	provided := r.URL.Query().Get("token")
 	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
 }
 
 func (srv *Lobbies) debug(w http.ResponseWriter, r *http.Request) {
-	if !isAdmin(r) {
+	if !srv.isAdmin(r) {
 		http.NotFound(w, r)
 		return
 	}
@@ -72,6 +122,40 @@ func (srv *Lobbies) debug(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(data)
 }
 
+// kick is the admin view's kick/ban form: player=<id>, action=kick|ban|banip.
+func (srv *Lobbies) kick(w http.ResponseWriter, r *http.Request) {
+	if !srv.isAdmin(r) {
+		http.NotFound(w, r)
+		return
+	}
+	srv.lobbiesMu.RLock()
+	l, ok := srv.lobbies[chi.URLParam(r, "lobby")]
+	srv.lobbiesMu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	opts := game.KickOptions{Reason: "removed by an admin"}
+	switch r.FormValue("action") {
+	case "kick":
+	case "ban":
+		opts.Ban = true
+	case "banip":
+		opts.Ban, opts.BanIP = true, true
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	player := r.FormValue("player")
+	if err := l.state.Kick(player, opts); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Info().Str("lobby", l.ID).Str("player", player).Str("action", r.FormValue("action")).Msg("Admin removed player")
+	http.Redirect(w, r, "/view?token="+url.QueryEscape(r.URL.Query().Get("token")), http.StatusSeeOther)
+}
+
 type lobbyView struct {
 	ID           string
 	Clients      int
@@ -80,6 +164,10 @@ type lobbyView struct {
 	Updates      int64
 	Age          string
 	LastActivity string
+	// quota rejections: new players refused, updates refused for size
+	RejectedPlayers int64
+	RejectedUpdates int64
+	Banned          []string
 }
 
 var viewTemplate = template.Must(template.New("view").Parse(`<!doctype html>
@@ -97,24 +185,40 @@ var viewTemplate = template.Must(template.New("view").Parse(`<!doctype html>
 	.online { color: #7fd4a8; }
 	.offline { color: #6b7a72; }
 	.empty { color: #6b7a72; padding: 2rem 0; }
+	form { display: inline; }
+	button { background: none; border: 1px solid #35654d; color: #8fb8a3; font: inherit; font-size: 0.7rem; cursor: pointer; }
+	button:hover { color: #d7e2dc; }
 </style>
 </head>
 <body>
 <h1>Active lobbies ({{len .Lobbies}})</h1>
+<p class="offline">Refused: {{.Quotas.Lobbies}} new lobbies · {{.Quotas.Clients}} sockets over the lobby cap · {{.Quotas.ConnsPerIP}} sockets over the per-IP cap</p>
 {{if .Lobbies}}
 <table>
-<tr><th>Lobby</th><th>Clients</th><th>Players</th><th>State</th><th>Updates</th><th>Age</th><th>Last activity</th><th></th></tr>
+<tr><th>Lobby</th><th>Clients</th><th>Players</th><th>State</th><th>Updates</th><th>Refused</th><th>Age</th><th>Last activity</th><th></th></tr>
 {{range .Lobbies}}
 <tr>
 	<td>{{.ID}}</td>
 	<td>{{.Clients}}</td>
 	<td>
+		{{$lobby := .ID}}
 		{{range .Players}}
-			<div class="{{if .Connected}}online{{else}}offline{{end}}">{{.ID}} {{if .Connected}}●{{else}}○{{end}}</div>
+			<div class="{{if .Connected}}online{{else}}offline{{end}}">{{.ID}} {{if .Connected}}●{{else}}○{{end}} <span class="offline">{{.Role}}</span>
+				<form method="post" action="/{{$lobby}}/kick?token={{$.Token}}">
+					<input type="hidden" name="player" value="{{.ID}}" />
+					<button name="action" value="kick">kick</button>
+					<button name="action" value="ban">ban</button>
+					<button name="action" value="banip">ban + IP</button>
+				</form>
+			</div>
+		{{end}}
+		{{range .Banned}}
+			<div class="offline">{{.}} ⊘ banned</div>
 		{{end}}
 	</td>
 	<td>{{printf "%.1f" .StateKB}} KB</td>
 	<td>{{.Updates}}</td>
+	<td>{{.RejectedPlayers}} joins / {{.RejectedUpdates}} updates</td>
 	<td>{{.Age}}</td>
 	<td>{{.LastActivity}}</td>
 	<td><a href="/{{.ID}}/debug?token={{$.Token}}">state</a></td>
@@ -128,7 +232,7 @@ var viewTemplate = template.Must(template.New("view").Parse(`<!doctype html>
 </html>`))
 
 func (srv *Lobbies) view(w http.ResponseWriter, r *http.Request) {
-	if !isAdmin(r) {
+	if !srv.isAdmin(r) {
 		http.NotFound(w, r)
 		return
 	}
@@ -152,6 +256,10 @@ func (srv *Lobbies) view(w http.ResponseWriter, r *http.Request) {
 			Updates:      stats.Updates,
 			Age:          time.Since(stats.CreatedAt).Round(time.Second).String(),
 			LastActivity: time.Since(stats.LastActivity).Round(time.Second).String() + " ago",
+
+			RejectedPlayers: stats.RejectedPlayers,
+			RejectedUpdates: stats.RejectedUpdates,
+			Banned:          stats.Banned,
 		})
 	}
 	sort.Slice(views, func(i, j int) bool { return views[i].ID < views[j].ID })
@@ -159,6 +267,7 @@ func (srv *Lobbies) view(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	err := viewTemplate.Execute(w, map[string]any{
 		"Lobbies": views,
+		"Quotas":  srv.QuotaStats(),
 		"Token":   r.URL.Query().Get("token"),
 	})
 	if err != nil {
@@ -166,20 +275,43 @@ func (srv *Lobbies) view(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (srv *Lobbies) handleWebsocket(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+// connectTimeout is how long a new socket has to send its connect message.
+const connectTimeout = 10 * time.Second
+
+var errNoConnect = errors.New("expected a connect message first")
 
+// readConnect reads a new socket's first message, which must be its connect,
+// and returns the secret in it: {"secret"}, empty for a first join (see
+// game.Welcome). The secret rides in a frame rather than the URL, which
+// proxies and access logs keep.
+func readConnect(conn *websocket.Conn) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	var msg game.Message
+	if err := wsjson.Read(ctx, conn, &msg); err != nil || msg.Type != "connect" {
+		return "", errNoConnect
+	}
+	var v struct {
+		Secret string `json:"secret"`
+	}
+	if msg.Value != nil && json.Unmarshal(msg.Value, &v) != nil {
+		return "", errNoConnect
+	}
+	return v.Secret, nil
+}
+
+func (srv *Lobbies) handleWebsocket(w http.ResponseWriter, r *http.Request) {
 	// Upgrade HTTP connection to websocket
+	// a page on any other site must not be able to open sockets into our
+	// lobbies from a visitor's browser; Accept answers those with a 403
 	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
-		InsecureSkipVerify: true, // Fix this when you go to prod
+		OriginPatterns: srv.cfg.Origins,
 	})
 	if err != nil {
-		log.Error().Msgf("Failed to upgrade connection: %v", err)
+		log.Warn().Str("origin", r.Header.Get("Origin")).Msgf("Failed to upgrade connection: %v", err)
 		return
 	}
-	// scenario seeds / TTS deck imports carry full card lists and blow past the
-	// 32KB default; a failed read silently drops the update AND the client
-	conn.SetReadLimit(1 << 20)
+	conn.SetReadLimit(srv.cfg.ReadLimit)
 
 	// TODO: More validation
 	lobbyID := r.URL.Query().Get("lobby")
@@ -190,23 +322,75 @@ func (srv *Lobbies) handleWebsocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// ?role=spectator joins read-only; anything else asks for a seat at the table
+	role := game.RolePlayer
+	switch r.URL.Query().Get("role") {
+	case "", string(game.RolePlayer):
+	case string(game.RoleSpectator):
+		role = game.RoleSpectator
+	default:
+		_ = conn.Close(websocket.StatusPolicyViolation, "unknown role")
+		return
+	}
+
 	log.Info().
 		Str("lobby", lobbyID).
 		Str("player", playerID).
+		Str("role", string(role)).
 		Msg("Connecting to lobby")
 
-	lobby := srv.lobby(lobbyID)
+	ip := srv.clientIP(r)
+	if err := srv.acquireIP(ip); err != nil {
+		log.Warn().Str("ip", ip).Msg("Refusing connection: " + err.Error())
+		_ = conn.Close(websocket.StatusTryAgainLater, err.Error())
+		return
+	}
+
+	secret, err := readConnect(conn)
+	if err != nil {
+		srv.releaseIP(ip)
+		log.Warn().Str("lobby", lobbyID).Str("player", playerID).Msg("Refusing connection: " + err.Error())
+		_ = conn.Close(websocket.StatusPolicyViolation, err.Error())
+		return
+	}
+
+	lobby, err := srv.lobby(lobbyID)
+	if err != nil {
+		srv.releaseIP(ip)
+		log.Warn().Str("lobby", lobbyID).Msg("Refusing connection: " + err.Error())
+		_ = conn.Close(websocket.StatusTryAgainLater, err.Error())
+		return
+	}
 
 	// TODO: Have AddClient be a func that makes the client and returns it
-	client := lobby.AddClient(playerID, conn)
+	client, err := lobby.AddClient(playerID, secret, ip, conn, role)
+	if err != nil {
+		srv.releaseIP(ip)
+		if errors.Is(err, ErrTooManyClients) {
+			srv.rejected.clients.Add(1)
+		}
+		log.Warn().Str("lobby", lobbyID).Str("player", playerID).Msg("Refusing connection: " + err.Error())
+		status := websocket.StatusTryAgainLater
+		if errors.Is(err, game.ErrBanned) || errors.Is(err, game.ErrWrongSecret) {
+			status = websocket.StatusPolicyViolation
+		}
+		_ = conn.Close(status, err.Error())
+		return
+	}
+	client.release = func() { srv.releaseIP(ip) }
 	log.Info().
 		Str("lobby", lobbyID).
 		Str("player", playerID).
 		Msg("player connected to lobby")
 
-	go lobby.clientRead(ctx, client)
-	go lobby.clientWrite(ctx, client)
+	go lobby.clientRead(client)
+	go lobby.clientWrite(client)
+	go lobby.clientPing(client)
+	lobby.state.Welcome(playerID)
 	lobby.state.SyncPlayerState(playerID)
+	lobby.state.ReplayChat(playerID)
 
-	<-ctx.Done()
+	// r.Context() isn't canceled for a hijacked connection; the client's is,
+	// when it unsubscribes or the lobby closes
+	<-client.ctx.Done()
 }
@@ -0,0 +1,42 @@
+package lobby
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/jollygrin/tts-server/game"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconnectPresentsTheWelcomeSecret(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{})
+	alice := dial(t, ts, "mine", "alice", nil)
+	m := nextMessage(t, alice, "welcome")
+	var v struct{ Secret string }
+	require.NoError(t, json.Unmarshal(m.Value, &v))
+	require.NotEmpty(t, v.Secret)
+	nextMessage(t, alice, "sync")
+
+	// the id alone is not enough to join as alice…
+	requireClosedWith(t, dial(t, ts, "mine", "alice", nil), websocket.StatusPolicyViolation, game.ErrWrongSecret.Error())
+	requireClosedWith(t, dialWithSecret(t, ts, "mine", "alice", "guess", nil), websocket.StatusPolicyViolation, game.ErrWrongSecret.Error())
+	// …the secret is, sent in the connect message and never in the URL
+	again := dialWithSecret(t, ts, "mine", "alice", v.Secret, nil)
+	nextMessage(t, again, "sync")
+}
+
+func TestSocketMustOpenWithConnect(t *testing.T) {
+	_, ts := quotaServer(t, Quotas{})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(ts.URL, "http")+"/ws?lobby=mine&player=alice", nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.CloseNow() })
+	require.NoError(t, wsjson.Write(ctx, conn, game.Message{Type: "update", Value: json.RawMessage(`{}`)}))
+	requireClosedWith(t, conn, websocket.StatusPolicyViolation, errNoConnect.Error())
+}
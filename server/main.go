@@ -1,43 +1,98 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/jollygrin/tts-server/config"
 	"github.com/jollygrin/tts-server/lobby"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-// Command line flags
+// Command line flags. -addr, -debug and -metrics-addr beat the config file
+// and the environment when given.
 var (
-	addr  = flag.String("addr", ":8080", "http service address")
-	debug = flag.Bool("debug", false, "enable debug logging")
+	configPath  = flag.String("config", os.Getenv("CONFIG_FILE"), "JSON config file (see config.Config)")
+	addr        = flag.String("addr", "", "http service address")
+	debug       = flag.Bool("debug", false, "enable debug logging")
+	metricsAddr = flag.String("metrics-addr", "", "optional address serving /metrics without the admin token")
 )
 
 func main() {
 	flag.Parse()
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
-	if *debug {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-		log.Info().Msg("Debug logging enabled")
+	cfg, err := config.Load(*configPath)
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Addr = *addr
+		case "debug":
+			cfg.Debug = *debug
+		case "metrics-addr":
+			cfg.MetricsAddr = *metricsAddr
+		}
+	})
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
 	}
 
-	// Check if PORT environment variable is set (used by Railway)
-	port := os.Getenv("PORT")
-	if port != "" {
-		*addr = ":" + port
-		log.Info().Msgf("Using PORT from environment: %s", port)
+	if cfg.Debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		log.Info().Msg("Debug logging enabled")
 	}
+	redacted, _ := json.Marshal(cfg.Redacted())
+	log.Info().RawJSON("config", redacted).Msg("Loaded configuration")
 
-	srv := lobby.New()
+	srv := lobby.New(cfg.Lobby())
 	mux := srv.Router()
 
+	// a separate listener for the scraper — keep it off the public network
+	if cfg.MetricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", srv.MetricsHandler())
+		go func() {
+			log.Info().Msgf("Metrics listening on %s", cfg.MetricsAddr)
+			if err := http.ListenAndServe(cfg.MetricsAddr, metricsMux); err != nil {
+				log.Err(err).Msg("metrics server failed")
+			}
+		}()
+	}
+
 	// Start the server
-	log.Info().Msgf("Server listening on %s", *addr)
-	if err := http.ListenAndServe(*addr, mux); err != nil {
-		log.Err(err).Msg("server failed")
+	server := &http.Server{Addr: cfg.Addr, Handler: mux}
+	go func() {
+		log.Info().Msgf("Server listening on %s", cfg.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Msg("server failed")
+		}
+	}()
+
+	// on SIGTERM, fail /readyz first and give the platform time to notice,
+	// then close the lobbies and stop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Info().Msgf("Draining for %s", time.Duration(cfg.DrainDelay))
+	srv.Drain()
+	time.Sleep(time.Duration(cfg.DrainDelay))
+	srv.Shutdown()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Err(err).Msg("server shutdown failed")
 	}
+	log.Info().Msg("Server stopped")
 }
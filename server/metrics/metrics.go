@@ -0,0 +1,151 @@
+// Package metrics holds the process-wide Prometheus collectors the lobby and
+// game packages update. Per-lobby gauges are collected at scrape time by the
+// lobby package itself, which knows the live lobbies.
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+const namespace = "tts"
+
+var (
+	// MessagesIn counts messages read from client sockets, by type.
+	MessagesIn = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_in_total",
+		Help:      "Messages received from clients, by type.",
+	}, []string{"type"})
+
+	// MessagesOut counts messages queued to client sockets, by type — one per
+	// recipient, so a broadcast to four players counts four.
+	MessagesOut = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_out_total",
+		Help:      "Messages queued to clients, by type, one per recipient.",
+	}, []string{"type"})
+
+	// MergeSeconds times merging an update patch into lobby state.
+	MergeSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "merge_duration_seconds",
+		Help:      "Time spent merging an update into lobby state.",
+		Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 9), // 10µs … ~650ms
+	})
+
+	// Dropped counts messages discarded instead of blocking, by where they
+	// were dropped: send_buffer_full (a slow client) or game_out_full (a
+	// presence patch the lobby wasn't draining).
+	Dropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dropped_messages_total",
+		Help:      "Messages dropped instead of blocking, by reason.",
+	}, []string{"reason"})
+
+	// RateLimitDisconnects counts sockets closed for exceeding the rate limit.
+	RateLimitDisconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_disconnects_total",
+		Help:      "Sockets closed for exceeding the message rate limit.",
+	})
+
+	// HeartbeatTimeouts counts sockets closed for missing a pong.
+	HeartbeatTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "heartbeat_timeouts_total",
+		Help:      "Sockets closed for not answering a ping within the pong timeout.",
+	})
+
+	// Resyncs counts fresh syncs sent to clients that missed messages.
+	Resyncs = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resyncs_total",
+		Help:      "Syncs sent to clients after some of their messages were dropped.",
+	})
+
+	// StallDisconnects counts sockets closed for staying behind too long.
+	StallDisconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stall_disconnects_total",
+		Help:      "Sockets closed after their send buffer stayed full past the stall timeout.",
+	})
+
+	// LobbiesCollected counts idle empty lobbies garbage-collected.
+	LobbiesCollected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lobbies_collected_total",
+		Help:      "Idle empty lobbies removed after their TTL.",
+	})
+)
+
+// Drop reasons for Dropped.
+const (
+	DropSendBufferFull = "send_buffer_full"
+	DropGameOutFull    = "game_out_full"
+)
+
+// Collectors returns every process-wide collector, for registering with a
+// registry.
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		MessagesIn,
+		MessagesOut,
+		MergeSeconds,
+		Dropped,
+		RateLimitDisconnects,
+		HeartbeatTimeouts,
+		Resyncs,
+		StallDisconnects,
+		LobbiesCollected,
+	}
+}
+
+// knownTypes bounds the type label: the type field comes straight from
+// clients, and an unbounded label is a memory leak in every scraper.
+var knownTypes = map[string]bool{
+	"sync":         true,
+	"welcome":      true,
+	"connect":      true,
+	"update":       true,
+	"camera":       true,
+	"error":        true,
+	"reset":        true,
+	"kick":         true,
+	"ban":          true,
+	"setRole":      true,
+	"resetSecret":  true,
+	"chat":         true,
+	"chatHistory":  true,
+	"log":          true,
+	"setTurnOrder": true,
+	"endTurn":      true,
+	"passTurn":     true,
+	"setRound":     true,
+	"setClocks":    true,
+	"startClock":   true,
+	"stopClock":    true,
+	"pauseClock":   true,
+	"resumeClock":  true,
+	"clockExpired": true,
+	"claimSeat":    true,
+	"releaseSeat":  true,
+	"setCapacity":  true,
+	"admit":        true,
+	"waiting":      true,
+	"rollExpr":     true,
+	"roll":         true,
+	"increment":    true,
+	"decrement":    true,
+	"peek":         true,
+	"reveal":       true,
+	"revealEnd":    true,
+	"bagDraw":      true,
+	"bagInsert":    true,
+}
+
+// TypeLabel maps a message type to its metric label; unknown types collapse
+// into "other".
+func TypeLabel(msgType string) string {
+	if knownTypes[msgType] {
+		return msgType
+	}
+	return "other"
+}
@@ -10,8 +10,10 @@
  * the item exists twice, or not at all.
  *
  * Contents are never rendered anywhere; only the remaining count is (see
- * Piece.svelte). They do travel in shared state, so "hidden" is a property of
- * the UI, not of the wire — exactly as it is for a TTS save file.
+ * Piece.svelte). Offline (/setup) they live in the local state. In a lobby the
+ * server holds them (server/game/bags.go) and state only carries the bag's
+ * `count`, so both verbs are sent as `bagDraw` / `bagInsert` and the server
+ * resolves them and broadcasts the resulting patch.
  */
 
 import { get } from 'svelte/store';
@@ -20,6 +22,8 @@ import { buildPiece, slugify, type PieceState } from './piece';
 import { bagDrawOffset, PIECE_DEFAULT_RADIUS, PIECE_REST_Y } from '$lib/utils/constants-pieces';
 import { CARD_REST_Y } from '$lib/utils/constants-cards';
 import { clampToTable } from '$lib/utils/transforms/drop';
+import { createWsMetaData } from '$lib/utils/transforms/websocket';
+import { isWebSocketConnected, sendMessage } from '$lib/websocket/connection';
 import type { BagDrawMode, BagItem, CardDTO, GameDTO } from '../types';
 
 type Vec3 = [number, number, number];
@@ -87,12 +91,28 @@ function nextCardId(taken: Set<string>, owner: string, bagSlug: string, code: st
  * Returns the draw, or null when there is nothing to draw (not a bag, empty,
  * or no owner to spawn for). An infinite bag keeps its contents and clones the
  * item instead — so it never empties.
+ *
+ * In a lobby the server picks the item, so this sends a `bagDraw` with where a
+ * piece or a card would land and returns null: the draw arrives as an update.
  */
 function drawFromBag(bagId: string): BagDraw | null {
 	const state = get(gameStore);
 	const bag = bagState(bagId);
 	if (!bag) return null;
 
+	if (isWebSocketConnected()) {
+		sendMessage({
+			...createWsMetaData(),
+			type: 'bagDraw',
+			value: {
+				bag: bagId,
+				position: drawPosition(state, bag, PIECE_REST_Y),
+				cardPosition: drawPosition(state, bag, CARD_REST_Y)
+			}
+		});
+		return null;
+	}
+
 	const contents = bag.contents ?? [];
 	const index = pickDrawIndex(contents.length, bag.drawMode);
 	if (index < 0) return null;
@@ -193,6 +213,16 @@ function returnToBag(bagId: string, entityId: string): boolean {
 		update.cards = { [entityId]: null };
 	}
 
+	if (isWebSocketConnected()) {
+		// the server holds the pool: it takes the entity off the table and
+		// grows the bag in one broadcast patch
+		sendMessage({
+			...createWsMetaData(),
+			type: 'bagInsert',
+			value: { bag: bagId, entity: entityId }
+		});
+		return true;
+	}
 	update.pieces[bagId] = { contents: [...(bag.contents ?? []), item] };
 	gameStore.updateState(update as StateUpdate);
 	return true;
@@ -202,7 +232,8 @@ function returnToBag(bagId: string, entityId: string): boolean {
 function bagCount(bagId: string): number | null {
 	const bag = bagState(bagId);
 	if (!bag) return 0;
-	return bag.infinite ? null : (bag.contents ?? []).length;
+	// a lobby's bags only carry the count the server keeps
+	return bag.infinite ? null : (bag.count ?? (bag.contents ?? []).length);
 }
 
 export const bagActions = {
@@ -175,6 +175,11 @@ export type PieceDTO = {
 	 * No UI ever renders it.
 	 */
 	contents?: BagItem[];
+	/**
+	 * bags only — how many items are left. In a lobby the server keeps
+	 * `contents` to itself and writes this instead; offline it is absent.
+	 */
+	count?: number;
 	/** bags only — draw order; treated as `'random'` when absent */
 	drawMode?: BagDrawMode;
 	/** bags only — draws clone instead of removing (TTS Infinite_Bag) */
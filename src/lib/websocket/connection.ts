@@ -2,13 +2,25 @@ import { gameActions } from '$lib/store/game/actions';
 import toast from 'svelte-french-toast';
 
 export type WebSocketMessage = {
-	// 'connect' is outbound-only: the join handshake sent by joinLobby().
+	// 'connect' is outbound-only: the first frame of every socket, carrying our
+	// player secret, if we have one — never the URL, which proxies log.
 	// Inbound traffic is 'sync' | 'update' | 'error' | 'camera' — presence
 	// arrives as an ordinary 'update' merge patch on players[id].connected,
 	// while 'camera' is the ephemeral tier (SPEC.md §4c): relayed to peers,
 	// never merged into lobby state. It flows both ways. Old clients log an
 	// unknown-type warning and carry on, so it is safe to roll out one-sided.
-	type: 'connect' | 'sync' | 'update' | 'error' | 'camera';
+	// 'bagDraw' and 'bagInsert' are outbound-only: the server resolves them
+	// and answers with an 'update'. 'welcome' is inbound-only and handled
+	// here: it carries our player secret (see secretKey).
+	type:
+		| 'connect'
+		| 'sync'
+		| 'update'
+		| 'error'
+		| 'camera'
+		| 'bagDraw'
+		| 'bagInsert'
+		| 'welcome';
 	path?: string[];
 	value?: any;
 	playerId: string;
@@ -34,7 +46,13 @@ const CACHE_SERVER_URL =
 const SECURITY = CACHE_SERVER_URL.includes('localhost') ? 'ws' : 'wss';
 const WS_SERVER_URL = `${SECURITY}://${CACHE_SERVER_URL}/ws`;
 
+// The server issues each player id a secret on its first join to a lobby and
+// refuses a reconnect as that id without it — otherwise anyone who read our id
+// off an update could join as us and take our role. Each lobby issues its own.
+const secretKey = (lobbyId: string) => `playerSecret:${lobbyId}`;
+
 // State
+let lobby: string | null = null; // the lobby the socket is for, to file its secret under
 let socket: WebSocket | null = null;
 let isConnected = false;
 let isConnecting = false;
@@ -74,12 +92,14 @@ export async function connect(lobbyId: string, serverUrl?: string): Promise<bool
 	}
 
 	const playerId = player.id;
-	let wsUrl = `${WS_SERVER_URL}?lobby=${lobbyId}&player=${playerId}`;
+	const query = `?lobby=${lobbyId}&player=${playerId}`;
+	let wsUrl = `${WS_SERVER_URL}${query}`;
 	if (serverUrl) {
 		const host = normalizeServerHost(serverUrl);
 		const security = host.includes('localhost') ? 'ws' : 'wss';
-		wsUrl = `${security}://${host}/ws?lobby=${lobbyId}&player=${playerId}`;
+		wsUrl = `${security}://${host}/ws${query}`;
 	}
+	lobby = lobbyId;
 
 	console.log(`Connecting to websocket server at ${wsUrl}`);
 	return new Promise((resolve) => {
@@ -87,6 +107,16 @@ export async function connect(lobbyId: string, serverUrl?: string): Promise<bool
 			socket = new WebSocket(wsUrl);
 
 			socket.onopen = () => {
+				// the server reads nothing else until it has this
+				const secret = localStorage.getItem(secretKey(lobbyId));
+				socket?.send(
+					JSON.stringify({
+						type: 'connect',
+						playerId,
+						timestamp: Date.now(),
+						value: secret ? { secret } : undefined
+					} satisfies WebSocketMessage)
+				);
 				console.log('Connected to websocket server. Reconnection attempts:', reconnectAttempts);
 				toast(`Connected to lobby: ${lobbyId}`);
 				isConnected = true;
@@ -161,20 +191,8 @@ export async function joinLobby(lobbyId: string): Promise<boolean> {
 		if (!connected) return false;
 	}
 
-	const playerId = gameActions.getMyId();
-	if (!playerId) {
-		console.error('No player found in store');
-		return false;
-	}
-
-	// Send join message
-	const joinMessage: WebSocketMessage = {
-		type: 'connect',
-		playerId: playerId,
-		timestamp: Date.now()
-	};
-
-	return sendMessage(joinMessage);
+	// connect() already sent the join handshake as the socket opened
+	return true;
 }
 
 /**
@@ -221,6 +239,12 @@ export function onMessage(callback: MessageCallback): void {
 function handleMessage(message: WebSocketMessage): void {
 	// Log the message — except the ephemeral camera stream, which arrives
 	// several times a second per peer and would bury everything else
+	if (message.type === 'welcome') {
+		// never logged: it is the one thing that proves we are us
+		if (lobby && message.value?.secret)
+			localStorage.setItem(secretKey(lobby), message.value.secret);
+		return;
+	}
 	if (message.type !== 'camera') console.log('Received message:', message);
 
 	// Call all registered callbacks